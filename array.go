@@ -0,0 +1,80 @@
+package pgpush
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// quotes an array element escaping backslashes and double quotes
+func QuoteArrayElement(val string) string {
+	val = strings.Replace(val, `\`, `\\`, -1)
+	val = strings.Replace(val, `"`, `\"`, -1)
+	return `"` + val + `"`
+}
+
+// encodes a slice from a feature's properties as an array literal
+// nil elements become NULL and a nil value is returned as is
+func EncodeArray(value interface{}) (interface{}, error) {
+	return encodeArray(value, func(val interface{}) (string, error) {
+		return formatScalar(val), nil
+	})
+}
+
+// encodes a slice from a feature's properties as an array literal
+// for the given array column, integral floats are written as plain
+// integers to integer arrays as json numbers always decode to float64
+func ArrayValue(column Column, value interface{}) (interface{}, error) {
+	if column.Type.Element().Category() != "int" {
+		return EncodeArray(value)
+	}
+	return encodeArray(value, func(val interface{}) (string, error) {
+		if v, boolval := val.(float64); boolval {
+			if v != math.Trunc(v) || math.IsInf(v, 0) {
+				return "", fmt.Errorf("cannot convert %v to an integer for column %s", v, column.Name)
+			}
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+		return formatScalar(val), nil
+	})
+}
+
+// encodes each element of a slice or array with the given function
+func encodeArray(value interface{}, format func(interface{}) (string, error)) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	vv := reflect.ValueOf(value)
+	if vv.Kind() != reflect.Slice && vv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("cannot convert %T to an array", value)
+	}
+
+	array_lines := make([]string, vv.Len())
+	for pos := 0; pos < vv.Len(); pos++ {
+		val := vv.Index(pos).Interface()
+		if val == nil {
+			array_lines[pos] = "NULL"
+			continue
+		}
+		text, err := format(val)
+		if err != nil {
+			return nil, err
+		}
+		array_lines[pos] = QuoteArrayElement(text)
+	}
+	return "{" + strings.Join(array_lines, ",") + "}", nil
+}
+
+// formats a scalar value as text, floats are written without
+// an exponent so 1e6 gives 1000000 and not 1e+06
+func formatScalar(val interface{}) string {
+	switch v := val.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(val)
+}
@@ -0,0 +1,64 @@
+package pgpush
+
+import (
+	"testing"
+)
+
+func TestEncodeArray(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{nil, nil},
+		{[]interface{}{}, "{}"},
+		{[]string{"a", `b"c`, `d\e`}, `{"a","b\"c","d\\e"}`},
+		{[]interface{}{"a", nil, 2.5}, `{"a",NULL,"2.5"}`},
+		{[]float64{1e6, 0.000001, 1.5}, `{"1000000","0.000001","1.5"}`},
+		{[]float32{1e6, 0.1}, `{"1000000","0.1"}`},
+		{[]bool{true, false}, `{"true","false"}`},
+		{[]int{1, 2}, `{"1","2"}`},
+	}
+	for _, test := range tests {
+		got, err := EncodeArray(test.value)
+		if err != nil {
+			t.Errorf("EncodeArray(%v) error: %v", test.value, err)
+		} else if got != test.want {
+			t.Errorf("EncodeArray(%v) = %v, want %v", test.value, got, test.want)
+		}
+	}
+
+	_, err := EncodeArray("not an array")
+	if err == nil {
+		t.Errorf("EncodeArray of a string should fail")
+	}
+}
+
+func TestArrayValue(t *testing.T) {
+	tests := []struct {
+		columntype ColumnType
+		value      interface{}
+		want       interface{}
+		fails      bool
+	}{
+		{IntegerArray, []interface{}{1.0, 1e6, nil}, `{"1","1000000",NULL}`, false},
+		{BigIntArray, []float64{-3, 12345678901}, `{"-3","12345678901"}`, false},
+		{BigIntArray, []int64{7}, `{"7"}`, false},
+		{IntegerArray, []interface{}{1.5}, nil, true},
+		{DoubleArray, []interface{}{1e6, 1.5}, `{"1000000","1.5"}`, false},
+		{TextArray, []interface{}{1e21}, `{"1000000000000000000000"}`, false},
+	}
+	for _, test := range tests {
+		got, err := ArrayValue(Column{Name: "values", Type: test.columntype}, test.value)
+		if test.fails {
+			if err == nil {
+				t.Errorf("ArrayValue(%s, %v) should fail", test.columntype, test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ArrayValue(%s, %v) error: %v", test.columntype, test.value, err)
+		} else if got != test.want {
+			t.Errorf("ArrayValue(%s, %v) = %v, want %v", test.columntype, test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package pgpush
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/pgtype"
+	"github.com/paulmach/go.geojson"
+	"strings"
+	"time"
+)
+
+// the savepoint each isolated insert runs under
+var batchSavepoint = "pgpush_batch"
+
+// returns the rows per batch for the table capped so a batch
+// never uses more than MaxBindParameters
+func (table *Table) batchSize() int {
+	size := table.BatchSize
+	if size <= 0 {
+		size = DefaultIncrement
+	}
+	if len(table.Columns) > 0 && size*len(table.Columns) > MaxBindParameters {
+		size = MaxBindParameters / len(table.Columns)
+	}
+	return size
+}
+
+// returns whether the current batch should be flushed
+func (table *Table) batchDue() bool {
+	if table.Count >= table.batchSize() {
+		return true
+	}
+	if table.FlushBytes > 0 && table.CurrentBytes >= table.FlushBytes {
+		return true
+	}
+	return table.FlushInterval > 0 && time.Since(table.BatchStarted) >= table.FlushInterval
+}
+
+// returns the approximate size in bytes of an insert value
+func valueSize(val interface{}) int {
+	switch val := val.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(val)
+	case []byte:
+		return len(val)
+	case *pgtype.JSONB:
+		return len(val.Bytes)
+	case *pgtype.Hstore:
+		size := 0
+		for k, v := range val.Map {
+			size += len(k) + len(v.String)
+		}
+		return size
+	}
+	return 8
+}
+
+// flushes the current batch
+func (table *Table) Flush() error {
+	return table.FlushContext(context.Background())
+}
+
+// flushes the current batch into the open transaction, any error other
+// than a BatchError rolls the transaction back, the table doesn't flush
+// on its own with FlushInterval until a feature is added so this can be
+// called on a timer when features arrive slowly
+func (table *Table) FlushContext(ctx context.Context) error {
+	if table.closed {
+		return ErrTableClosed
+	}
+	if table.Count == 0 {
+		return nil
+	}
+	err := table.flush(ctx)
+	if ctx.Err() != nil {
+		return table.abort(ctx.Err())
+	}
+	_, partial := err.(*BatchError)
+	if err != nil && !partial {
+		return table.abort(err)
+	}
+	table.Batches++
+	return err
+}
+
+// creates the insert statement for a batch of n rows
+// the statement for a full batch is built once and reused
+func (table *Table) batchStmt(n int) string {
+	full := n == table.batchSize()
+	if full && n == table.fullRows && table.fullStmt != "" {
+		return table.fullStmt
+	}
+	ncols := len(table.Columns)
+	var stmt strings.Builder
+	stmt.Grow(len(table.InsertStmt) + n*(len(table.InsertValue)+ncols*4))
+	stmt.WriteString(table.InsertStmt)
+	positions := make([]interface{}, ncols)
+	for row := 0; row < n; row++ {
+		for pos := range positions {
+			positions[pos] = row*ncols + pos + 1
+		}
+		fmt.Fprintf(&stmt, table.InsertValue, positions...)
+	}
+	// trimming the trailing ", "
+	batchstmt := stmt.String()
+	batchstmt = batchstmt[:len(batchstmt)-2]
+	if full {
+		table.fullStmt, table.fullRows = batchstmt, n
+	}
+	return batchstmt
+}
+
+// runs a statement under a savepoint, a failed statement is rolled
+// back to the savepoint leaving the transaction usable and returned
+// as stmterr, err is only for failures the transaction can't recover from
+func (table *Table) execSavepoint(ctx context.Context, stmt string, args []interface{}) (stmterr error, err error) {
+	_, err = table.Tx.ExecEx(ctx, "SAVEPOINT "+batchSavepoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, stmterr = table.Tx.ExecEx(ctx, stmt, nil, args...)
+	if stmterr == nil {
+		_, err = table.Tx.ExecEx(ctx, "RELEASE SAVEPOINT "+batchSavepoint, nil)
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	_, err = table.Tx.ExecEx(ctx, "ROLLBACK TO SAVEPOINT "+batchSavepoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = table.Tx.ExecEx(ctx, "RELEASE SAVEPOINT "+batchSavepoint, nil)
+	return stmterr, err
+}
+
+// inserts the current batch bisecting it on failure until every good
+// row is inserted and each bad row is found, the bad rows are rejected
+// and returned as a BatchError
+func (table *Table) flushIsolated(ctx context.Context) error {
+	first := table.Inserts - table.Count
+	rows := table.Count
+	ncols := len(table.Columns)
+	values, features := table.CurrentInterfaceList, table.CurrentFeatures
+	table.resetBatch()
+
+	start := time.Now()
+	failed, err := bisect(0, rows, func(offset int, n int) (error, error) {
+		return table.execSavepoint(ctx, table.batchStmt(n), values[offset*ncols:(offset+n)*ncols])
+	})
+	if err != nil {
+		table.pending(features)
+		tableerr := newTableError(table.TableName, OpInsert, err)
+		tableerr.First, tableerr.Last = first, first+rows-1
+		table.flushed(rows, time.Since(start), tableerr)
+		return tableerr
+	}
+	rowerrs := make([]RowError, len(failed))
+	for pos, row := range failed {
+		tableerr := newTableError(table.TableName, OpInsert, row.Err)
+		tableerr.First, tableerr.Last = first+row.Offset, first+row.Offset
+		rowerrs[pos] = RowError{Index: first + row.Offset, Feature: features[row.Offset], Err: tableerr}
+	}
+	table.flushed(rows-len(rowerrs), time.Since(start), nil)
+	if len(rowerrs) == 0 {
+		table.pending(features)
+		return nil
+	}
+
+	bad := make(map[int]bool, len(rowerrs))
+	for _, rowerr := range rowerrs {
+		bad[rowerr.Index-first] = true
+	}
+	for pos, feature := range features {
+		if !bad[pos] {
+			table.pending([]*geojson.Feature{feature})
+		}
+	}
+
+	for _, rowerr := range rowerrs {
+		table.reject(rowerr.Feature, rowerr.Err)
+	}
+	return &BatchError{TableName: table.TableName, Rows: rowerrs}
+}
+
+// a row that failed on its own while bisecting a batch
+type failedRow struct {
+	Offset int
+	Err    error
+}
+
+// runs exec on the rows from offset halving every range that fails until
+// each good row is inserted and every bad row has failed on its own
+// exec returns stmterr for a range the database refused and err for
+// anything bisecting can't recover from which stops it
+func bisect(offset int, n int, exec func(offset int, n int) (stmterr error, err error)) ([]failedRow, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	stmterr, err := exec(offset, n)
+	if err != nil || stmterr == nil {
+		return nil, err
+	}
+	if n == 1 {
+		return []failedRow{{Offset: offset, Err: stmterr}}, nil
+	}
+	half := n / 2
+	failed, err := bisect(offset, half, exec)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := bisect(offset+half, n-half, exec)
+	if err != nil {
+		return nil, err
+	}
+	return append(failed, rest...), nil
+}
@@ -0,0 +1,187 @@
+package pgpush
+
+import (
+	"errors"
+	"fmt"
+	"github.com/paulmach/go.geojson"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a fake batch insert that refuses any range holding a bad row
+// and records the rows of every range it accepts
+type fakeBatch struct {
+	bad      map[int]bool
+	inserted []int
+	calls    int
+	fatalAt  int
+}
+
+var errFatal = errors.New("connection lost")
+
+func (batch *fakeBatch) exec(offset int, n int) (error, error) {
+	batch.calls++
+	if batch.fatalAt > 0 && batch.calls == batch.fatalAt {
+		return nil, errFatal
+	}
+	for row := offset; row < offset+n; row++ {
+		if batch.bad[row] {
+			return errors.New("bad row"), nil
+		}
+	}
+	for row := offset; row < offset+n; row++ {
+		batch.inserted = append(batch.inserted, row)
+	}
+	return nil, nil
+}
+
+func TestBisect(t *testing.T) {
+	tests := []struct {
+		name string
+		rows int
+		bad  []int
+	}{
+		{"no bad rows", 8, nil},
+		{"one bad row among many", 10, []int{6}},
+		{"bad first row", 7, []int{0}},
+		{"bad last row", 7, []int{6}},
+		{"every row bad", 5, []int{0, 1, 2, 3, 4}},
+		{"bad rows in both halves", 9, []int{1, 2, 7}},
+		{"single bad row", 1, []int{0}},
+		{"empty batch", 0, nil},
+	}
+	for _, test := range tests {
+		batch := &fakeBatch{bad: map[int]bool{}}
+		for _, row := range test.bad {
+			batch.bad[row] = true
+		}
+		failed, err := bisect(0, test.rows, batch.exec)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+
+		offsets := []int{}
+		for _, row := range failed {
+			offsets = append(offsets, row.Offset)
+			if row.Err == nil {
+				t.Errorf("%s: row %d failed without an error", test.name, row.Offset)
+			}
+		}
+		want := test.bad
+		if want == nil {
+			want = []int{}
+		}
+		if !reflect.DeepEqual(offsets, want) {
+			t.Errorf("%s: failed rows %v, want %v", test.name, offsets, want)
+		}
+
+		// every good row is inserted exactly once and in order
+		good := []int{}
+		for row := 0; row < test.rows; row++ {
+			if !batch.bad[row] {
+				good = append(good, row)
+			}
+		}
+		if len(batch.inserted) == 0 {
+			batch.inserted = []int{}
+		}
+		if !reflect.DeepEqual(batch.inserted, good) {
+			t.Errorf("%s: inserted rows %v, want %v", test.name, batch.inserted, good)
+		}
+	}
+}
+
+func TestBisectFatal(t *testing.T) {
+	batch := &fakeBatch{bad: map[int]bool{3: true}, fatalAt: 3}
+	failed, err := bisect(0, 8, batch.exec)
+	if err != errFatal {
+		t.Errorf("error = %v, want %v", err, errFatal)
+	}
+	if failed != nil {
+		t.Errorf("failed rows %v after a fatal error, want none", failed)
+	}
+	if batch.calls != 3 {
+		t.Errorf("exec called %d times, want bisecting to stop at the fatal error", batch.calls)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	tests := []struct {
+		batchsize int
+		ncols     int
+		want      int
+	}{
+		{0, 5, DefaultIncrement},
+		{200, 5, 200},
+		{100000, 10, MaxBindParameters / 10},
+	}
+	for _, test := range tests {
+		columns := make([]Column, test.ncols)
+		for pos := range columns {
+			columns[pos] = Column{Name: string(rune('a' + pos)), Type: Text}
+		}
+		table := NewTable("sizes", columns)
+		table.BatchSize = test.batchsize
+		got := table.batchSize()
+		if got != test.want {
+			t.Errorf("batchSize with BatchSize %d and %d columns = %d, want %d", test.batchsize, test.ncols, got, test.want)
+		}
+	}
+}
+
+// a dead letter recording the features it's sent
+type fakeDeadLetter struct {
+	features []*geojson.Feature
+}
+
+func (deadletter *fakeDeadLetter) WriteRejected(tablename string, feature *geojson.Feature, reason error) error {
+	deadletter.features = append(deadletter.features, feature)
+	return nil
+}
+
+func TestPendingBound(t *testing.T) {
+	defer func(max int) { MaxUncommitted = max }(MaxUncommitted)
+	MaxUncommitted = 3
+
+	deadletter := &fakeDeadLetter{}
+	table := NewTable("pending", []Column{{Name: "a", Type: Text}})
+	table.DeadLetter = deadletter
+	features := make([]*geojson.Feature, 5)
+	for pos := range features {
+		features[pos] = geojson.NewPointFeature([]float64{float64(pos), 0})
+	}
+	table.pending(features[:2])
+	table.pending(features[2:])
+	if len(table.uncommitted) != 3 || table.unkept != 2 {
+		t.Fatalf("kept %d features and counted %d, want 3 and 2", len(table.uncommitted), table.unkept)
+	}
+
+	table.abort(errors.New("lost"))
+	if !reflect.DeepEqual(deadletter.features, features[:3]) {
+		t.Errorf("dead lettered %d features, want the first 3", len(deadletter.features))
+	}
+	if table.uncommitted != nil || table.unkept != 0 {
+		t.Errorf("kept %d features and counted %d after the rollback, want none", len(table.uncommitted), table.unkept)
+	}
+}
+
+func TestBatchStmt(t *testing.T) {
+	table := NewTable("stmts", []Column{{Name: "a", Type: Text}, {Name: "b", Type: Text}})
+	table.BatchSize = 3
+	want := table.InsertStmt + fmt.Sprintf(table.InsertValue, 1, 2) + fmt.Sprintf(table.InsertValue, 3, 4)
+	if got := table.batchStmt(2); got != want[:len(want)-2] {
+		t.Errorf("batchStmt(2) = %q, want %q", got, want[:len(want)-2])
+	}
+	full := table.batchStmt(3)
+	if !strings.HasSuffix(full, fmt.Sprintf(strings.TrimSuffix(table.InsertValue, ", "), 5, 6)) {
+		t.Errorf("batchStmt(3) = %q, want it to end with the third row", full)
+	}
+
+	// the cached statement is rebuilt once the columns change
+	table.setColumns(append(table.Columns, Column{Name: "c", Type: Text}))
+	if got := table.batchStmt(3); got == full || !strings.HasSuffix(got, fmt.Sprintf(strings.TrimSuffix(table.InsertValue, ", "), 7, 8, 9)) {
+		t.Errorf("batchStmt(3) after adding a column = %q", got)
+	}
+}
@@ -0,0 +1,219 @@
+package pgpush
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// the table checkpoints are kept in when a Checkpointer has a database
+var CheckpointTable = "pgpush_checkpoints"
+
+// the checkpoints of every table an import writes to
+type ImportCheckpoint struct {
+	Input  string                `json:"input"`
+	Tables map[string]Checkpoint `json:"tables"`
+}
+
+// records the commits of an import so a restarted import can skip
+// the input each table already committed
+// with a DB the checkpoint is written in the same transaction as the
+// rows it covers and the file is only a cache, without one the file is
+// written right after each commit and a crash between the two repeats
+// at most the input of that one commit for that table
+type Checkpointer struct {
+	Filename   string
+	Checkpoint ImportCheckpoint
+	DB         DB
+	offset     int64 // the input offset the next commits record
+}
+
+// returns an identity for an input file that changes when the file
+// does, its absolute path, size and modification time
+func InputID(filename string) (string, error) {
+	abspath, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abspath)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d:%d", abspath, info.Size(), info.ModTime().UnixNano()), nil
+}
+
+// opens the checkpoint file for an import of the given input
+// a missing file starts a new checkpoint, an empty filename
+// gives a checkpointer that only commits
+func OpenCheckpointer(filename string, input string) (*Checkpointer, error) {
+	checkpointer := &Checkpointer{
+		Filename:   filename,
+		Checkpoint: ImportCheckpoint{Input: input, Tables: map[string]Checkpoint{}},
+	}
+	if filename == "" {
+		return checkpointer, nil
+	}
+
+	bytevals, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return checkpointer, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(bytevals, &checkpointer.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	if checkpointer.Checkpoint.Input != input {
+		return nil, fmt.Errorf("checkpoint %s is for %s not %s", filename, checkpointer.Checkpoint.Input, input)
+	}
+	if checkpointer.Checkpoint.Tables == nil {
+		checkpointer.Checkpoint.Tables = map[string]Checkpoint{}
+	}
+	return checkpointer, nil
+}
+
+// opens the checkpoints of an import of the given input kept in the
+// CheckpointTable of the database creating it if it doesn't exist
+// the checkpoint file if given is only written as a cache
+func OpenCheckpointerDB(ctx context.Context, db DB, filename string, input string) (*Checkpointer, error) {
+	createstmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	input text,
+	table_name text,
+	committed bigint,
+	input_offset bigint,
+	committed_at timestamptz,
+	primary key (input, table_name)
+);`, QuoteTableName(CheckpointTable))
+	_, err := db.ExecEx(ctx, createstmt, nil)
+	if err != nil {
+		return nil, newTableError(CheckpointTable, OpCreate, err)
+	}
+
+	checkpointer := &Checkpointer{
+		Filename:   filename,
+		Checkpoint: ImportCheckpoint{Input: input, Tables: map[string]Checkpoint{}},
+		DB:         db,
+	}
+	selectstmt := fmt.Sprintf("SELECT table_name, committed, input_offset, committed_at FROM %s WHERE input = $1", QuoteTableName(CheckpointTable))
+	rows, err := db.QueryEx(ctx, selectstmt, nil, input)
+	if err != nil {
+		return nil, newTableError(CheckpointTable, OpQuery, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var checkpoint Checkpoint
+		var committed int64
+		err = rows.Scan(&checkpoint.TableName, &committed, &checkpoint.Offset, &checkpoint.CommittedAt)
+		if err != nil {
+			return nil, newTableError(CheckpointTable, OpQuery, err)
+		}
+		checkpoint.Committed = int(committed)
+		checkpointer.Checkpoint.Tables[checkpoint.TableName] = checkpoint
+	}
+	if rows.Err() != nil {
+		return nil, newTableError(CheckpointTable, OpQuery, rows.Err())
+	}
+	return checkpointer, nil
+}
+
+// returns whether a table has a checkpoint to resume from
+func (checkpointer *Checkpointer) Resuming(tablename string) bool {
+	_, boolval := checkpointer.Checkpoint.Tables[tablename]
+	return boolval
+}
+
+// returns whether the input at the given offset was already
+// committed to the table
+func (checkpointer *Checkpointer) Skip(tablename string, offset int64) bool {
+	return offset < checkpointer.Checkpoint.Tables[tablename].Offset
+}
+
+// carries a table's committed count over from its checkpoint
+func (checkpointer *Checkpointer) Resume(table *Table) {
+	committed := checkpointer.Checkpoint.Tables[table.TableName].Committed
+	table.Inserts, table.Committed = committed, committed
+}
+
+// makes every commit of the table record its checkpoint, the ones its
+// CommitRows, CommitBatches or CommitInterval policy makes as well, at
+// the offset last given to Advance
+func (checkpointer *Checkpointer) Track(table *Table) {
+	table.checkpointer = checkpointer
+}
+
+// records that the input before offset has been added to the tables,
+// the next commit of each tracked table checkpoints it
+func (checkpointer *Checkpointer) Advance(offset int64) {
+	if offset > checkpointer.offset {
+		checkpointer.offset = offset
+	}
+}
+
+// commits the table and records that the input up to offset
+// is committed to it
+func (checkpointer *Checkpointer) Commit(ctx context.Context, table *Table, offset int64) error {
+	checkpointer.Track(table)
+	checkpointer.Advance(offset)
+	return table.CommitContext(ctx)
+}
+
+// upserts the checkpoint of a flushed table in its open transaction
+// so the rows and the offset commit together, run by the table
+// right before it commits
+func (checkpointer *Checkpointer) record(ctx context.Context, table *Table) error {
+	if checkpointer.DB == nil {
+		return nil
+	}
+	err := table.ensureTx(ctx)
+	if err != nil {
+		return newTableError(table.TableName, OpCommit, err)
+	}
+	upsertstmt := fmt.Sprintf(`INSERT INTO %s AS checkpoint (input, table_name, committed, input_offset, committed_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (input, table_name) DO UPDATE SET
+	committed = excluded.committed,
+	input_offset = greatest(checkpoint.input_offset, excluded.input_offset),
+	committed_at = excluded.committed_at`, QuoteTableName(CheckpointTable))
+	_, err = table.Tx.ExecEx(ctx, upsertstmt, nil, checkpointer.Checkpoint.Input, table.TableName, int64(table.Inserts), checkpointer.offset, time.Now())
+	if err != nil {
+		return table.abort(newTableError(table.TableName, OpCommit, err))
+	}
+	return nil
+}
+
+// keeps the checkpoint of a table that just committed, writing the
+// checkpoint file, a table's offset never goes back so input
+// committed before a restart stays skipped
+func (checkpointer *Checkpointer) committed(table *Table) error {
+	checkpoint := table.Checkpoint()
+	checkpoint.Offset = checkpointer.offset
+	if previous := checkpointer.Checkpoint.Tables[table.TableName].Offset; previous > checkpoint.Offset {
+		checkpoint.Offset = previous
+	}
+	checkpointer.Checkpoint.Tables[table.TableName] = checkpoint
+	return checkpointer.write()
+}
+
+// writes the checkpoint file by replacing it so a crash mid write
+// never leaves a partial checkpoint
+func (checkpointer *Checkpointer) write() error {
+	if checkpointer.Filename == "" {
+		return nil
+	}
+	bytevals, err := json.Marshal(checkpointer.Checkpoint)
+	if err != nil {
+		return err
+	}
+	tmpfilename := checkpointer.Filename + ".tmp"
+	err = ioutil.WriteFile(tmpfilename, bytevals, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpfilename, checkpointer.Filename)
+}
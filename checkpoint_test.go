@@ -0,0 +1,137 @@
+package pgpush
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointerFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgpush")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "import.checkpoint.json")
+	ctx := context.Background()
+
+	// a missing file starts a new checkpoint
+	checkpointer, err := OpenCheckpointer(filename, "input-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpointer.Resuming("roads") {
+		t.Errorf("a new checkpointer is resuming roads")
+	}
+
+	table := NewTable("roads", []Column{{Name: "name", Type: Text}})
+	err = checkpointer.Commit(ctx, table, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the offset never goes back
+	err = checkpointer.Commit(ctx, table, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := checkpointer.Checkpoint.Tables["roads"].Offset; got != 10 {
+		t.Errorf("offset after committing 10 then 4 = %d, want 10", got)
+	}
+
+	// reading the file back
+	reopened, err := OpenCheckpointer(filename, "input-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Resuming("roads") || reopened.Resuming("rivers") {
+		t.Errorf("reopened checkpoint tables = %v, want only roads", reopened.Checkpoint.Tables)
+	}
+	tests := []struct {
+		offset int64
+		skip   bool
+	}{
+		{0, true},
+		{9, true},
+		{10, false},
+		{11, false},
+	}
+	for _, test := range tests {
+		if got := reopened.Skip("roads", test.offset); got != test.skip {
+			t.Errorf("Skip(roads, %d) = %v, want %v", test.offset, got, test.skip)
+		}
+	}
+	if reopened.Skip("rivers", 0) {
+		t.Errorf("Skip for a table without a checkpoint = true")
+	}
+
+	// resuming carries the committed count over
+	reopened.Checkpoint.Tables["roads"] = Checkpoint{TableName: "roads", Committed: 25, Offset: 10}
+	resumed := NewTable("roads", []Column{{Name: "name", Type: Text}})
+	reopened.Resume(resumed)
+	if resumed.Inserts != 25 || resumed.Committed != 25 {
+		t.Errorf("resumed counts = %d, %d, want 25, 25", resumed.Inserts, resumed.Committed)
+	}
+
+	// a checkpoint for another input is refused
+	_, err = OpenCheckpointer(filename, "input-b")
+	if err == nil {
+		t.Errorf("OpenCheckpointer accepted a checkpoint of another input")
+	}
+}
+
+func TestCheckpointerAdvance(t *testing.T) {
+	checkpointer := &Checkpointer{Checkpoint: ImportCheckpoint{Tables: map[string]Checkpoint{}}}
+	checkpointer.Advance(5)
+	checkpointer.Advance(3)
+	if checkpointer.offset != 5 {
+		t.Errorf("offset after advancing to 5 then 3 = %d, want 5", checkpointer.offset)
+	}
+
+	// a tracked table records the advanced offset with every commit
+	table := NewTable("roads", []Column{{Name: "name", Type: Text}})
+	checkpointer.Track(table)
+	err := table.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := checkpointer.Checkpoint.Tables["roads"].Offset; got != 5 {
+		t.Errorf("offset after a tracked commit = %d, want 5", got)
+	}
+}
+
+func TestInputID(t *testing.T) {
+	file, err := ioutil.TempFile("", "pgpush")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("one")
+	file.Close()
+
+	first, err := InputID(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	abspath, _ := filepath.Abs(file.Name())
+	if !strings.HasPrefix(first, abspath+":") {
+		t.Errorf("InputID(%s) = %s, want the absolute path first", file.Name(), first)
+	}
+	err = ioutil.WriteFile(file.Name(), []byte("three"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := InputID(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("InputID didn't change after the file did")
+	}
+	_, err = InputID(filepath.Join(os.TempDir(), "pgpush-missing-input"))
+	if err == nil {
+		t.Errorf("InputID of a missing file should fail")
+	}
+}
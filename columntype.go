@@ -0,0 +1,53 @@
+package pgpush
+
+import (
+	"fmt"
+	"strings"
+)
+
+// a varchar column of at most n characters
+func VarCharN(n int) ColumnType {
+	return ColumnType(fmt.Sprintf("varchar(%d)", n))
+}
+
+// a char column of exactly n characters
+func CharN(n int) ColumnType {
+	return ColumnType(fmt.Sprintf("char(%d)", n))
+}
+
+// a numeric column with the given precision and scale
+func NumericPS(precision int, scale int) ColumnType {
+	return ColumnType(fmt.Sprintf("numeric(%d,%d)", precision, scale))
+}
+
+// an array column of the given element type
+// slices in feature properties are written to it as arrays
+func ArrayOf(columntype ColumnType) ColumnType {
+	return columntype + "[]"
+}
+
+// returns the column type without its length or precision
+// i.e. varchar(20) gives varchar
+func (columntype ColumnType) Base() ColumnType {
+	val := string(columntype)
+	start := strings.Index(val, "(")
+	end := strings.Index(val, ")")
+	if start != -1 && end > start {
+		val = strings.TrimSpace(val[:start]) + val[end+1:]
+	}
+	return ColumnType(val)
+}
+
+// returns the element type of an array column type
+func (columntype ColumnType) Element() ColumnType {
+	return ColumnType(strings.TrimSuffix(string(columntype), "[]"))
+}
+
+// returns the TypeMap category of the column type, parameterized
+// types share their base type's category and arrays are "array"
+func (columntype ColumnType) Category() string {
+	if strings.HasSuffix(string(columntype), "[]") {
+		return "array"
+	}
+	return TypeMap[columntype.Base()]
+}
@@ -0,0 +1,53 @@
+package pgpush
+
+import (
+	"time"
+)
+
+// a record of how much of a load has been committed
+// a load restarted after a crash can skip the first Committed
+// features it would add to the table
+type Checkpoint struct {
+	TableName   string    `json:"table_name"`
+	Committed   int       `json:"committed"`
+	CommittedAt time.Time `json:"committed_at"`
+	Offset      int64     `json:"offset"` // the importer's input position, set by a Checkpointer
+}
+
+// returns the checkpoint as of the table's last commit
+func (table *Table) Checkpoint() Checkpoint {
+	return Checkpoint{
+		TableName:   table.TableName,
+		Committed:   table.Committed,
+		CommittedAt: table.CommittedAt,
+	}
+}
+
+// returns whether the table's auto commit policy calls for a commit
+// never in a transaction the table was given as it can't commit it
+func (table *Table) commitDue() bool {
+	if table.externalTx {
+		return false
+	}
+	if table.CommitRows > 0 && table.Inserts-table.Committed >= table.CommitRows {
+		return true
+	}
+	if table.CommitBatches > 0 && table.Batches >= table.CommitBatches {
+		return true
+	}
+	return table.CommitInterval > 0 && table.Tx != nil && time.Since(table.TxStarted) >= table.CommitInterval
+}
+
+// records a commit and reports the new checkpoint
+func (table *Table) committed() {
+	table.Committed = table.Inserts
+	table.Batches = 0
+	table.committedColumns = nil
+	table.uncommitted = nil
+	table.unkept = 0
+	table.CommittedAt = time.Now()
+	table.logger().Info("transaction committed", "table", table.TableName, "features", table.Committed)
+	if table.Hooks.Committed != nil {
+		table.Hooks.Committed(table.Checkpoint())
+	}
+}
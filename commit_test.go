@@ -0,0 +1,87 @@
+package pgpush
+
+import (
+	"context"
+	"github.com/jackc/pgx"
+	"testing"
+	"time"
+)
+
+func TestCommitDue(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(table *Table)
+		want  bool
+	}{
+		{"no policy", func(table *Table) { table.Inserts = 1000 }, false},
+		{"rows below", func(table *Table) { table.CommitRows, table.Inserts, table.Committed = 10, 15, 6 }, false},
+		{"rows reached", func(table *Table) { table.CommitRows, table.Inserts, table.Committed = 10, 16, 6 }, true},
+		{"batches below", func(table *Table) { table.CommitBatches, table.Batches = 3, 2 }, false},
+		{"batches reached", func(table *Table) { table.CommitBatches, table.Batches = 3, 3 }, true},
+		{"interval without a transaction", func(table *Table) {
+			table.CommitInterval, table.TxStarted = time.Second, time.Now().Add(-time.Hour)
+		}, false},
+		{"interval below", func(table *Table) {
+			table.CommitInterval, table.Tx, table.TxStarted = time.Hour, new(pgx.Tx), time.Now()
+		}, false},
+		{"interval reached", func(table *Table) {
+			table.CommitInterval, table.Tx, table.TxStarted = time.Second, new(pgx.Tx), time.Now().Add(-time.Hour)
+		}, true},
+		// the caller's transaction is never committed so every policy is ignored
+		{"external transaction", func(table *Table) {
+			table.externalTx, table.Tx = true, new(pgx.Tx)
+			table.CommitRows, table.Inserts = 10, 100
+			table.CommitBatches, table.Batches = 1, 5
+			table.CommitInterval, table.TxStarted = time.Second, time.Now().Add(-time.Hour)
+		}, false},
+	}
+	for _, test := range tests {
+		table := NewTable("commits", []Column{{Name: "a", Type: Text}})
+		test.setup(table)
+		if got := table.commitDue(); got != test.want {
+			t.Errorf("%s: commitDue = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCommittedHook(t *testing.T) {
+	table := NewTable("commits", []Column{{Name: "a", Type: Text}})
+	var checkpoints []Checkpoint
+	table.Hooks.Committed = func(checkpoint Checkpoint) {
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	table.Inserts, table.Batches = 25, 3
+	table.committed()
+	table.Inserts = 40
+	table.committed()
+
+	if len(checkpoints) != 2 {
+		t.Fatalf("Committed called %d times, want 2", len(checkpoints))
+	}
+	for pos, want := range []int{25, 40} {
+		checkpoint := checkpoints[pos]
+		if checkpoint.TableName != "commits" || checkpoint.Committed != want || checkpoint.CommittedAt.IsZero() {
+			t.Errorf("checkpoint %d = %+v, want %d committed to commits", pos, checkpoint, want)
+		}
+	}
+	if table.Batches != 0 || table.Checkpoint() != checkpoints[1] {
+		t.Errorf("table after commit has %d batches and checkpoint %+v, want 0 and %+v", table.Batches, table.Checkpoint(), checkpoints[1])
+	}
+}
+
+// rows past CommitRows keep filling the batch in a transaction the
+// table was given instead of flushing one at a time
+func TestCommitRowsExternalTx(t *testing.T) {
+	table := NewTable("commits", []Column{{Name: "a", Type: Text}})
+	table.Tx, table.externalTx = new(pgx.Tx), true
+	table.CommitRows = 2
+	for n := 0; n < 5; n++ {
+		err := table.addRow(context.Background(), []interface{}{"a"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if table.Count != 5 {
+		t.Errorf("batch holds %d rows, want all 5", table.Count)
+	}
+}
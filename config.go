@@ -1,6 +1,7 @@
 package pgpush
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/jackc/pgx"
@@ -9,9 +10,18 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var DefaultIncrement = 1000
+
+// the most flushed features a table keeps for its dead letter until
+// they're committed, the features past it are only counted
+var MaxUncommitted = 100000
+
+// the most bind parameters postgres allows in one statement
+const MaxBindParameters = 65535
+
 var DefaultSRID = 4326
 var WebMercatorSRID = 3857
 
@@ -23,10 +33,10 @@ var Integer ColumnType = "integer"   // int
 var BigInt ColumnType = "bigint"     // int
 
 // float types
-var Decimal ColumnType = "decimal" // float
-var Numeric ColumnType = "numeric" // float
-var Real ColumnType = "real"       // float
-//var Double ColumnType = "double"   // float
+var Decimal ColumnType = "decimal"         // float
+var Numeric ColumnType = "numeric"         // float
+var Real ColumnType = "real"               // float
+var Double ColumnType = "double precision" // float
 
 // serial types
 var SmallSerial ColumnType = "smallserial" // int
@@ -35,19 +45,22 @@ var BigSerial ColumnType = "bigserial"     // int
 
 // character types
 var VarChar ColumnType = "varchar" // string
-var Char ColumnType = "Char"       // string
+var Char ColumnType = "char"       // string
 var Text ColumnType = "text"       // string
 
+// uuid type
+var UUID ColumnType = "uuid" // string
+
 // Binary Data Types
 var Bytea ColumnType = "bytea" // string
 
 // timestamps & timezones
-var TimestampWithoutTimezone ColumnType = "timestamp without timezone" // int
-var TimestampWithTimezone ColumnType = "timestamp with timezone"       // int
-var Date ColumnType = "date"                                           // int
-var TimeWithoutTimezone ColumnType = "time without timezone"           // int
-var TimeWithTimezone ColumnType = "time with timezone"                 // int
-var Interval ColumnType = "interval"                                   // int
+var TimestampWithoutTimezone ColumnType = "timestamp without time zone" // timestamp
+var TimestampWithTimezone ColumnType = "timestamp with time zone"       // timestamp
+var Date ColumnType = "date"                                            // date
+var TimeWithoutTimezone ColumnType = "time without time zone"           // time
+var TimeWithTimezone ColumnType = "time with time zone"                 // time
+var Interval ColumnType = "interval"                                    // interval
 
 // boolean type
 var Boolean ColumnType = "boolean" // bool
@@ -58,6 +71,15 @@ var Geometry ColumnType = "geometry" // geometry
 // hstore column type
 var HStore ColumnType = "hstore_tags"
 
+// jsonb column type
+var JSONB ColumnType = "jsonb"
+
+// common array types, ArrayOf gives any other
+var TextArray = ArrayOf(Text)       // array
+var IntegerArray = ArrayOf(Integer) // array
+var BigIntArray = ArrayOf(BigInt)   // array
+var DoubleArray = ArrayOf(Double)   // array
+
 var TypeMap = map[ColumnType]string{
 	SmallInt: "int",
 	Integer:  "int",
@@ -66,7 +88,7 @@ var TypeMap = map[ColumnType]string{
 	Decimal: "float",
 	Numeric: "float",
 	Real:    "float",
-	//Double:  "float",
+	Double:  "float",
 
 	SmallSerial: "int",
 	Serial:      "int",
@@ -76,20 +98,24 @@ var TypeMap = map[ColumnType]string{
 	Char:    "string",
 	Text:    "string",
 
+	UUID: "string",
+
 	Bytea: "string",
 
-	TimestampWithoutTimezone: "int",
-	TimestampWithTimezone:    "int",
-	Date:                "int",
-	TimeWithoutTimezone: "int",
-	TimeWithTimezone:    "int",
-	Interval:            "int",
+	TimestampWithoutTimezone: "timestamp",
+	TimestampWithTimezone:    "timestamp",
+	Date:                     "date",
+	TimeWithoutTimezone:      "time",
+	TimeWithTimezone:         "time",
+	Interval:                 "interval",
 
 	Boolean: "bool",
 
 	Geometry: "geometry",
 
 	HStore: "hstore",
+
+	JSONB: "jsonb",
 }
 
 // column data type
@@ -98,6 +124,16 @@ type Column struct {
 	Type       ColumnType
 	TargetSRID int
 	GivenSRID  int
+	KeepColumn bool // keeps a string column out of the hstore column
+	PrimaryKey bool
+	CatchAll   bool // marks a jsonb column storing whole sets of properties for the exporters
+
+	// for timestamp, date and time columns the layout string values
+	// are parsed with, DefaultTimeLayouts are tried if empty
+	TimeLayout string
+	// the unit of numeric values for timestamp, date, time and interval
+	// columns i.e. time.Millisecond for epochs in ms, seconds if 0
+	EpochUnit time.Duration
 }
 
 // table structrue
@@ -105,57 +141,216 @@ type Table struct {
 	TableName            string
 	InsertStmt           string
 	CreateStmt           string
-	CurrentInsertStmt    string
+	CurrentInsertStmt    string // unused, a batch's statement is built when it's flushed
 	InsertValue          string
 	CurrentInterfaceList []interface{}
+	CurrentFeatures      []*geojson.Feature // only kept with a DeadLetter or IsolateFailures
 	Count                int
 	ColumnMap            map[string]string
 	Tx                   *pgx.Tx
 	Columns              []Column
 	Inserts              int
-	HStoreFormatString   string
 	HStoreColumns        []string
+	HStoreOmitMissing    bool // leaves missing properties out of the hstore instead of NULL
+	DynamicHStore        bool // places every property without a column in the hstore
+	JSONBMode            JSONBMode
+	Logger               Logger
+	Hooks                Hooks
+	DeadLetter           DeadLetter
+	closed               bool
+	IsolateFailures      bool          // bisects failed batches to insert every good row
+	BatchSize            int           // rows per batch, DefaultIncrement if 0
+	FlushBytes           int           // flushes once a batch's values reach this size
+	FlushInterval        time.Duration // flushes once a batch is this old
+	CurrentBytes         int
+	BatchStarted         time.Time
+	CommitRows           int           // commits once this many features are uncommitted
+	CommitBatches        int           // commits once this many batches are uncommitted
+	CommitInterval       time.Duration // commits once the transaction is this old
+	Committed            int           // features committed so far
+	Batches              int           // batches since the last commit
+	TxStarted            time.Time
+	CommittedAt          time.Time
+	EvolveSchema         bool // adds a column for every new property, locking the table until the next commit
+	Mapping              *PropertyMapping
+	committedColumns     []Column
+	uncommitted          []*geojson.Feature // flushed since the last commit, only kept with a DeadLetter
+	unkept               int                // flushed since the last commit past MaxUncommitted
+	fullStmt             string             // the insert statement of a full batch once built
+	fullRows             int
+	checkpointer         *Checkpointer // records a checkpoint with every commit when tracked
 	Conn                 *pgx.ConnPool
+	beginner             Beginner // nil when the table runs in a transaction it was given
+	pool                 *pgx.ConnPool
+	externalTx           bool
 }
 
 // Creates a table structure to map to.
-func CreateTable(tablename string, columns []Column, config pgx.ConnPoolConfig) (*Table, error) {
+// the mode decides what happens when the table already exists
+func CreateTable(tablename string, columns []Column, config pgx.ConnPoolConfig, mode CreateMode) (*Table, error) {
+	return CreateTableContext(context.Background(), tablename, columns, config, mode)
+}
+
+// Creates a table structure to map to using the given context
+// for the statements run while creating it.
+func CreateTableContext(ctx context.Context, tablename string, columns []Column, config pgx.ConnPoolConfig, mode CreateMode) (*Table, error) {
+	p, err := pgx.NewConnPool(config)
+	if err != nil {
+		return &Table{}, err
+	}
+	table, err := CreateTableDB(ctx, tablename, columns, p, mode)
+	if err != nil {
+		p.Close()
+		return &Table{}, err
+	}
+	table.pool = p
+	return table, nil
+}
+
+// Creates a table structure on an existing pool, connection or
+// transaction, see DB for how each is used.
+func CreateTableDB(ctx context.Context, tablename string, columns []Column, db DB, mode CreateMode) (*Table, error) {
+	table := NewTable(tablename, columns)
+
+	// creating extension for postgis
+	_, err := db.ExecEx(ctx, "create extension if not exists postgis;", nil)
+	if err != nil {
+		return &Table{}, newTableError(tablename, OpCreate, err)
+	}
+
+	// creating the schema if the table is in one
+	schema, _ := SplitTableName(tablename)
+	if schema != "" {
+		_, err = db.ExecEx(ctx, "create schema if not exists "+QuoteIdentifier(schema)+";", nil)
+		if err != nil {
+			return &Table{}, newTableError(tablename, OpCreate, err)
+		}
+	}
+
+	// creating extension for hstore
+	if table.hasType("hstore") {
+		_, err = db.ExecEx(ctx, "create extension if not exists hstore;", nil)
+		if err != nil {
+			return &Table{}, newTableError(tablename, OpCreate, err)
+		}
+	}
+
+	// beginning the table's transaction so preparing and creating the
+	// table commit with its first features or not at all
+	err = table.attach(ctx, db)
+	if err != nil {
+		return &Table{}, err
+	}
+	err = table.create(ctx, mode)
+	if err != nil {
+		if !table.externalTx {
+			table.Tx.Rollback()
+		}
+		return &Table{}, err
+	}
+	return table, nil
+}
+
+// prepares and creates the table in its transaction
+func (table *Table) create(ctx context.Context, mode CreateMode) error {
+	// handling an existing table
+	create, err := table.prepare(ctx, table.Tx, mode)
+	if err != nil {
+		return err
+	}
+
+	// exectuing create table stmt
+	if create {
+		_, err = table.Tx.ExecEx(ctx, table.CreateStmt, nil)
+		if err != nil {
+			return newTableError(table.TableName, OpCreate, err)
+		}
+	}
+	err = table.markCatchAll(ctx, table.Tx)
+	if err != nil {
+		return newTableError(table.TableName, OpCreate, err)
+	}
+	return nil
+}
+
+// opens an existing table laid out with the given columns for adding
+// features, nothing is created
+func OpenTable(tablename string, columns []Column, config pgx.ConnPoolConfig) (*Table, error) {
+	return OpenTableContext(context.Background(), tablename, columns, config)
+}
+
+// opens an existing table using the given context
+func OpenTableContext(ctx context.Context, tablename string, columns []Column, config pgx.ConnPoolConfig) (*Table, error) {
+	p, err := pgx.NewConnPool(config)
+	if err != nil {
+		return &Table{}, err
+	}
+	table, err := OpenTableDB(ctx, tablename, columns, p)
+	if err != nil {
+		p.Close()
+		return &Table{}, err
+	}
+	table.pool = p
+	return table, nil
+}
+
+// opens an existing table on an existing pool, connection or transaction
+func OpenTableDB(ctx context.Context, tablename string, columns []Column, db DB) (*Table, error) {
+	table := NewTable(tablename, columns)
+	err := table.attach(ctx, db)
+	if err != nil {
+		return &Table{}, err
+	}
+	return table, nil
+}
+
+// returns whether the table has a column of the given TypeMap type
+func (table *Table) hasType(mytype string) bool {
+	for _, column := range table.Columns {
+		if column.Type.Category() == mytype {
+			return true
+		}
+	}
+	return false
+}
+
+// builds the create and insert statements for a table structure
+// without running anything against the database
+func NewTable(tablename string, columns []Column) *Table {
 	columnmap := map[string]string{}
 	createlist, insertlist := []string{}, []string{}
 	var hstore_bool bool
 	for _, column := range columns {
-		mytype := TypeMap[column.Type]
+		mytype := column.Type.Category()
 		if mytype == "hstore" {
 			hstore_bool = true
 		}
 	}
-	hstore_lines := []string{}
 	hstore_columns := []string{}
 	//pos := 0
 	new_columns := []Column{}
 	column_names := []string{}
 	for _, column := range columns {
 		var hstore_val bool
-		mytype := TypeMap[column.Type]
-		val := fmt.Sprintf("%s %s", column.Name, string(column.Type))
-		if hstore_bool && mytype == "string" {
+		mytype := column.Type.Category()
+		val := fmt.Sprintf("%s %s", QuoteIdentifier(column.Name), string(column.Type))
+		if hstore_bool && mytype == "string" && !column.KeepColumn {
 			columnmap[column.Name] = mytype
-			hstore_lines = append(hstore_lines, fmt.Sprintf(`"%s" `, column.Name)+`=> "%s",`)
 			hstore_columns = append(hstore_columns, column.Name)
 			hstore_val = true
 		} else if strings.Contains(mytype, "hstore") {
 			insertlist = append(insertlist, "$%d")
 			//pos++
-			column_names = append(column_names, column.Name)
+			column_names = append(column_names, QuoteIdentifier(column.Name))
 			new_columns = append(new_columns, column)
-			val = fmt.Sprintf("%s %s", column.Name, "hstore")
+			val = fmt.Sprintf("%s %s", QuoteIdentifier(column.Name), "hstore")
 
 		} else if mytype != "geometry" {
 			columnmap[column.Name] = mytype
 			insertlist = append(insertlist, "$%d")
 			//pos++
 			new_columns = append(new_columns, column)
-			column_names = append(column_names, column.Name)
+			column_names = append(column_names, QuoteIdentifier(column.Name))
 		} else if mytype == "geometry" {
 			if column.GivenSRID == 0 {
 				column.GivenSRID = DefaultSRID
@@ -173,63 +368,37 @@ func CreateTable(tablename string, columns []Column, config pgx.ConnPoolConfig)
 			insertlist = append(insertlist, insertval)
 			//pos++
 			new_columns = append(new_columns, column)
-			column_names = append(column_names, column.Name)
+			column_names = append(column_names, QuoteIdentifier(column.Name))
+		}
+		if column.PrimaryKey {
+			val += " PRIMARY KEY"
 		}
 		if !hstore_val {
 			createlist = append(createlist, val)
 		}
 	}
 
-	hstore_string := ""
 	if hstore_bool {
-		val := strings.Join(hstore_lines, "\n")
-		val = val[:len(val)-1]
-		hstore_string = val
 		columns = new_columns
 	}
 	column_string := strings.Join(column_names, ", ")
 	createval := strings.Join(createlist, ",")
-	createstmt := fmt.Sprintf("CREATE TABLE %s (%s);", tablename, createval)
+	createstmt := fmt.Sprintf("CREATE TABLE %s (%s);", QuoteTableName(tablename), createval)
 	insertval := strings.Join(insertlist, ",")
-	insertstmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", tablename, column_string)
+	insertstmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", QuoteTableName(tablename), column_string)
 	insertvalupdate := fmt.Sprintf("(%s), ", insertval)
 
-	p, err := pgx.NewConnPool(config)
-	if err != nil {
-		return &Table{}, err
-	}
-
-	// creating extension for postgis
-	_, _ = p.Exec("create extension postgis;")
-
-	// creating extension for hstore
-	_, _ = p.Exec("create extension hstore;")
-
-	// exectuing create table stmt
-	_, err = p.Exec(createstmt)
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	tx, err := p.Begin()
-	if err != nil {
-		return &Table{}, err
-	}
 	return &Table{
-		TableName:          tablename,
-		InsertStmt:         insertstmt,
-		CreateStmt:         createstmt,
-		ColumnMap:          columnmap,
-		Tx:                 tx,
-		Columns:            columns,
-		Inserts:            0,
-		Conn:               p,
-		InsertValue:        insertvalupdate,
-		CurrentInsertStmt:  insertstmt,
-		HStoreColumns:      hstore_columns,
-		HStoreFormatString: hstore_string,
-	}, nil
-
+		TableName:         tablename,
+		InsertStmt:        insertstmt,
+		CreateStmt:        createstmt,
+		ColumnMap:         columnmap,
+		Columns:           columns,
+		Inserts:           0,
+		InsertValue:       insertvalupdate,
+		CurrentInsertStmt: insertstmt,
+		HStoreColumns:     hstore_columns,
+	}
 }
 
 // writes a value and returns the bytes of such value
@@ -267,8 +436,8 @@ func ParseValue(value interface{}) (interface{}, string) {
 func ValidPolygonFeature(feature *geojson.Feature) bool {
 	// simpl
 	totalbool := false
-	totalbool = len(feature.Geometry.Polygon) == 0
 	if feature.Geometry.Type == "Polygon" {
+		totalbool = len(feature.Geometry.Polygon) == 0
 		for _, i := range feature.Geometry.Polygon {
 			boolval := len(i) < 4
 			if boolval {
@@ -276,6 +445,7 @@ func ValidPolygonFeature(feature *geojson.Feature) bool {
 			}
 		}
 	} else {
+		totalbool = len(feature.Geometry.MultiPolygon) == 0
 		for _, i := range feature.Geometry.MultiPolygon {
 			for _, ii := range i {
 				boolval := len(ii) < 4
@@ -290,135 +460,421 @@ func ValidPolygonFeature(feature *geojson.Feature) bool {
 
 // adds a feature to the postgis table
 func (table *Table) AddFeature(feature *geojson.Feature) error {
+	return table.AddFeatureContext(context.Background(), feature)
+}
+
+// adds a feature to the postgis table, a batch insert run by this call
+// is cancelled with the context and the open transaction rolled back
+func (table *Table) AddFeatureContext(ctx context.Context, feature *geojson.Feature) error {
+	if table.closed {
+		return ErrTableClosed
+	}
+	if ctx.Err() != nil {
+		return table.abort(ctx.Err())
+	}
+	if table.Mapping != nil {
+		mapped, err := table.Mapping.apply(feature)
+		if err != nil {
+			return table.reject(feature, err)
+		}
+		feature = mapped
+	}
 	if strings.Contains(string(feature.Geometry.Type), "Polygon") {
 		totalbool := ValidPolygonFeature(feature)
 		if !totalbool {
-			return errors.New("Polygon Geometry Invalid.")
+			return table.reject(feature, errors.New("Polygon Geometry Invalid."))
+		}
+	}
+
+	// the values are built against the evolved columns before they're
+	// added so a feature that can't be stored doesn't alter the table
+	var added []Column
+	if table.EvolveSchema {
+		added = table.newColumns(feature)
+	}
+	columns := table.Columns
+	if len(added) > 0 {
+		table.Columns = append(columns[:len(columns):len(columns)], added...)
+	}
+	newlist, err := table.rowValues(feature)
+	table.Columns = columns
+	if err != nil {
+		return table.reject(feature, err)
+	}
+
+	var batcherr error
+	if len(added) > 0 {
+		batcherr = table.evolve(ctx, added)
+		_, partial := batcherr.(*BatchError)
+		if batcherr != nil && !partial {
+			return batcherr
 		}
 	}
+	err = table.addRow(ctx, newlist, feature)
+	if err != nil {
+		return err
+	}
+	return batcherr
+}
 
+// builds the values of a feature for each of the table's columns
+func (table *Table) rowValues(feature *geojson.Feature) ([]interface{}, error) {
 	newlist := []interface{}{}
-	newlist2 := []interface{}{}
-	for pos, i := range table.Columns {
-		newlist2 = append(newlist2, table.Count*len(table.Columns)+pos+1)
+	for _, i := range table.Columns {
 		if string(i.Type) == "hstore_tags" {
-			hstore_vals := []interface{}{}
-			for _, name := range table.HStoreColumns {
-				hstore_vals = append(hstore_vals, fmt.Sprint(feature.Properties[name]))
+			newlist = append(newlist, table.HStoreValue(i, feature))
+		} else if i.Type.Category() == "jsonb" {
+			val, err := table.JSONBValue(i, feature)
+			if err != nil {
+				return nil, err
 			}
-			newval := fmt.Sprintf(table.HStoreFormatString, hstore_vals...)
-			newlist = append(newlist, newval)
-
-		} else if string(i.Name) == "geometry" {
+			newlist = append(newlist, val)
+		} else if string(i.Name) == "geometry" || i.Type == Geometry {
 			geomb, err := EncodeGeometryWKB(feature.Geometry)
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			newlist = append(newlist, geomb)
+		} else if i.Type.Category() == "array" {
+			val, err := ArrayValue(i, feature.Properties[i.Name])
+			if err != nil {
+				return nil, err
+			}
+			newlist = append(newlist, val)
+		} else if IsTemporal(i.Type) {
+			val, err := TemporalValue(i, feature.Properties[i.Name])
+			if err != nil {
+				return nil, err
+			}
+			newlist = append(newlist, val)
 		} else {
-			val, boolval := feature.Properties[i.Name]
-			//fmt.Println(i, val, boolval)x
-			if !boolval {
-				newlist = append(newlist, nil)
-			} else {
-				newlist = append(newlist, fmt.Sprint(val))
+			val, err := propertyText(feature.Properties[i.Name])
+			if err != nil {
+				return nil, err
 			}
+			newlist = append(newlist, val)
 
 		}
 	}
-	table.CurrentInterfaceList = append(table.CurrentInterfaceList, newlist...)
-	table.CurrentInsertStmt += fmt.Sprintf(table.InsertValue, newlist2...)
+	return newlist, nil
+}
+
+// adds the values of a row to the current batch, flushing or
+// committing the batch when it's due
+// the feature is only kept when a DeadLetter or IsolateFailures needs it
+func (table *Table) addRow(ctx context.Context, values []interface{}, feature *geojson.Feature) error {
+	table.CurrentInterfaceList = append(table.CurrentInterfaceList, values...)
+	if table.keepFeatures() {
+		table.CurrentFeatures = append(table.CurrentFeatures, feature)
+	}
+	if table.Count == 0 {
+		table.BatchStarted = time.Now()
+	}
+	for _, val := range values {
+		table.CurrentBytes += valueSize(val)
+	}
 	table.Count++
+	table.Inserts++
+
+	if table.commitDue() {
+		return table.CommitContext(ctx)
+	} else if table.batchDue() {
+		return table.FlushContext(ctx)
+	}
+	return nil
+}
 
-	//
-	if table.Count != DefaultIncrement {
+// returns whether the features of a batch are kept for reporting failed rows
+func (table *Table) keepFeatures() bool {
+	return table.DeadLetter != nil || table.IsolateFailures
+}
 
-	} else {
-		//var oldtable *Table
-		//*oldtable = *table
-		//go func(oldtable *pgpush.Table) {
-		table.CurrentInsertStmt = table.CurrentInsertStmt[0 : len(table.CurrentInsertStmt)-2]
-		table.Tx.Exec(table.CurrentInsertStmt, table.CurrentInterfaceList...)
-		table.Count = 0
-		table.CurrentInsertStmt = table.InsertStmt
-		table.CurrentInterfaceList = []interface{}{}
+// executes the current batch insert and resets the batch
+// a batch the database refuses is rolled back to its savepoint and
+// returned as a BatchError for every row of it, with IsolateFailures
+// for the rows that failed, anything else is a TableError the
+// transaction can't recover from
+func (table *Table) flush(ctx context.Context) error {
+	err := table.ensureTx(ctx)
+	if err != nil {
+		return newTableError(table.TableName, OpInsert, err)
+	}
+	if table.IsolateFailures {
+		return table.flushIsolated(ctx)
+	}
+	first, last := table.Inserts-table.Count, table.Inserts-1
+	rows := table.Count
+	features := table.CurrentFeatures
+	start := time.Now()
+	// the batch runs under a savepoint so a failed batch only
+	// discards itself and not the batches flushed before it
+	stmterr, err := table.execSavepoint(ctx, table.batchStmt(rows), table.CurrentInterfaceList)
+	table.resetBatch()
+	if err != nil {
+		table.pending(features)
+		table.flushed(rows, time.Since(start), err)
+		tableerr := newTableError(table.TableName, OpInsert, err)
+		tableerr.First, tableerr.Last = first, last
+		return tableerr
+	}
+	table.flushed(rows, time.Since(start), stmterr)
+	if stmterr == nil {
+		table.pending(features)
+		return nil
+	}
 
+	tableerr := newTableError(table.TableName, OpInsert, stmterr)
+	tableerr.First, tableerr.Last = first, last
+	rowerrs := make([]RowError, rows)
+	for pos := range rowerrs {
+		rowerrs[pos] = RowError{Index: first + pos, Err: tableerr}
+		if pos < len(features) {
+			rowerrs[pos].Feature = features[pos]
+			table.deadLetter(features[pos], tableerr)
+		}
 	}
+	return &BatchError{TableName: table.TableName, Rows: rowerrs}
+}
 
-	return nil
+// clears the current batch
+func (table *Table) resetBatch() {
+	table.Count = 0
+	table.CurrentInsertStmt = table.InsertStmt
+	table.CurrentInterfaceList = []interface{}{}
+	table.CurrentFeatures = nil
+	table.CurrentBytes = 0
 }
 
-// commits the given features and refreshes the transaction
-func (table *Table) Commit() error {
-	if table.Count > 0 {
-		table.CurrentInsertStmt = table.CurrentInsertStmt[0 : len(table.CurrentInsertStmt)-2]
-		_, err := table.Tx.Exec(table.CurrentInsertStmt, table.CurrentInterfaceList...)
-		if err != nil {
-			fmt.Println(err)
-		}
-		table.Count = 0
-		table.CurrentInsertStmt = table.InsertStmt
-		table.CurrentInterfaceList = []interface{}{}
+// begins a transaction if the table doesn't have one open
+func (table *Table) ensureTx(ctx context.Context) error {
+	if table.Tx != nil {
+		return nil
+	}
+	beginner := table.beginner
+	if beginner == nil && table.Conn != nil {
+		beginner = table.Conn
 	}
-	err := table.Tx.Commit()
+	if beginner == nil {
+		return errors.New("pgpush: table has no connection to begin a transaction on")
+	}
+	tx, err := beginner.BeginEx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	tx, err := table.Conn.Begin()
 	table.Tx = tx
+	table.TxStarted = time.Now()
+	return nil
+}
+
+// discards the current batch and rolls back the open transaction
+// losing every feature since the last commit
+func (table *Table) rollback() error {
+	// a transaction the table was given is left to the caller
+	// so only the current batch is discarded
+	if table.externalTx {
+		table.Inserts -= table.Count
+		table.resetBatch()
+		return nil
+	}
+	table.resetBatch()
+	table.uncommitted = nil
+	table.unkept = 0
+	table.Inserts = table.Committed
+	table.Batches = 0
+	if table.committedColumns != nil {
+		table.setColumns(table.committedColumns)
+		table.committedColumns = nil
+	}
+	if table.Tx == nil {
+		return nil
+	}
+	err := table.Tx.Rollback()
+	table.Tx = nil
 	return err
 }
 
-// reads a given table from schema so features can be added in postgis
-func ReadTable(tablename string, config pgx.ConnPoolConfig) *Table {
-	p, err := pgx.NewConnPool(config)
-	if err != nil {
-		return &Table{}
+// keeps the features of a flushed batch until they're committed
+// so a rollback can dead letter them, up to MaxUncommitted features
+func (table *Table) pending(features []*geojson.Feature) {
+	if table.DeadLetter == nil || table.externalTx {
+		return
 	}
-	tx, err := p.Begin()
-	if err != nil {
-		return &Table{}
+	keep := MaxUncommitted - len(table.uncommitted)
+	if keep < 0 {
+		keep = 0
+	}
+	if keep < len(features) {
+		table.unkept += len(features) - keep
+		features = features[:keep]
 	}
+	table.uncommitted = append(table.uncommitted, features...)
+}
 
-	result, err := tx.Query("select column_name, data_type from INFORMATION_SCHEMA.COLUMNS where table_name = 'new';")
-	if err != nil {
-		fmt.Println(err)
+// rolls back the open transaction after a cancellation or failed insert,
+// the next batch begins a new transaction so the table stays usable
+// a TableError is widened to every feature since the last commit
+// as they're all rolled back and each of them is dead lettered
+func (table *Table) abort(err error) error {
+	var tableerr *TableError
+	if errors.As(err, &tableerr) && (tableerr.Op == OpInsert || tableerr.Op == OpCommit) && !table.externalTx {
+		tableerr.First, tableerr.Last = table.Committed, table.Inserts-1
 	}
-	columns := []Column{}
-	raw := map[string]string{}
-	for result.Next() {
-		var key, typeval string
-		err = result.Scan(&key, &typeval)
-		if err != nil {
-			fmt.Println(err)
+	table.logger().Warn("transaction rolled back", "table", table.TableName, "error", err)
+	if !table.externalTx {
+		for _, feature := range append(table.uncommitted, table.CurrentFeatures...) {
+			table.deadLetter(feature, err)
+		}
+		if table.unkept > 0 {
+			table.logger().Warn("rolled back features past MaxUncommitted weren't dead lettered", "table", table.TableName, "features", table.unkept)
 		}
-		raw[key] = typeval
-		columns = append(columns, Column{Name: key})
 	}
+	table.rollback()
+	return err
+}
 
-	insertlist := []string{}
-	for _, column := range columns {
-		if column.Name != "geometry" {
-			insertlist = append(insertlist, "$%d")
-		} else if column.Name == "geometry" {
-			insertval := "ST_GeomFromWKB($%d,4326)"
-			insertlist = append(insertlist, insertval)
+// commits the given features
+func (table *Table) Commit() error {
+	return table.CommitContext(context.Background())
+}
+
+// commits the given features, the transaction is rolled back if the
+// context is cancelled first, the next batch begins a new transaction
+func (table *Table) CommitContext(ctx context.Context) error {
+	if table.closed {
+		return ErrTableClosed
+	}
+	batcherr := table.FlushContext(ctx)
+	_, partial := batcherr.(*BatchError)
+	if batcherr != nil && !partial {
+		return batcherr
+	}
+	if table.checkpointer != nil {
+		err := table.checkpointer.record(ctx, table)
+		if err != nil {
+			return err
+		}
+	}
+	if table.Tx == nil && table.checkpointer != nil {
+		// nothing is uncommitted so the checkpoint is already current
+		err := table.checkpointer.committed(table)
+		if err != nil {
+			return err
+		}
+	}
+	if table.Tx == nil || table.externalTx {
+		return batcherr
+	}
+	err := table.Tx.CommitEx(ctx)
+	table.Tx = nil
+	if err != nil && ctx.Err() != nil {
+		return table.abort(ctx.Err())
+	} else if err != nil {
+		return table.abort(newTableError(table.TableName, OpCommit, err))
+	}
+	table.committed()
+	if table.checkpointer != nil {
+		err = table.checkpointer.committed(table)
+		if err != nil {
+			return err
 		}
 	}
+	return batcherr
+}
 
-	insertval := strings.Join(insertlist, ",")
-	insertstmt := fmt.Sprintf("INSERT INTO %s VALUES ", tablename)
-	insertvalupdate := fmt.Sprintf("(%s), ", insertval)
+// discards the current batch and rolls back the open transaction,
+// the table stays usable and the next batch begins a new transaction
+func (table *Table) Rollback() error {
+	if table.closed {
+		return ErrTableClosed
+	}
+	table.logger().Info("transaction rolled back", "table", table.TableName)
+	return table.rollback()
+}
 
-	return &Table{
+// flushes and commits any remaining features then closes the
+// connection pool if the table created it, every other method returns ErrTableClosed
+// afterwards and closing again does nothing so Close can be deferred
+// right after creating a table, call Rollback first to close without
+// committing
+func (table *Table) Close() error {
+	return table.CloseContext(context.Background())
+}
+
+// closes the table using the given context for the final commit
+func (table *Table) CloseContext(ctx context.Context) error {
+	if table.closed {
+		return nil
+	}
+	err := table.CommitContext(ctx)
+	if table.Tx != nil && !table.externalTx {
+		table.rollback()
+	}
+	table.closed = true
+	table.committedColumns = nil
+	if table.pool != nil {
+		table.pool.Close()
+	}
+	return err
+}
+
+// reads a given table from schema so features can be added in postgis
+func ReadTable(tablename string, config pgx.ConnPoolConfig) (*Table, error) {
+	return ReadTableContext(context.Background(), tablename, config)
+}
+
+// reads a given table from schema using the given context
+func ReadTableContext(ctx context.Context, tablename string, config pgx.ConnPoolConfig) (*Table, error) {
+	p, err := pgx.NewConnPool(config)
+	if err != nil {
+		return &Table{}, err
+	}
+	table, err := ReadTableDB(ctx, tablename, p)
+	if err != nil {
+		p.Close()
+		return &Table{}, err
+	}
+	table.pool = p
+	return table, nil
+}
+
+// reads a given table from schema on an existing pool, connection
+// or transaction
+func ReadTableDB(ctx context.Context, tablename string, db DB) (*Table, error) {
+	columns, _, err := readColumns(ctx, tablename, db)
+	if err != nil {
+		return &Table{}, err
+	}
+
+	insertstmt, insertvalue := insertStatements(tablename, columns)
+	table := &Table{
 		TableName:         tablename,
 		InsertStmt:        insertstmt,
-		Tx:                tx,
 		Columns:           columns,
 		Inserts:           0,
-		Conn:              p,
-		InsertValue:       insertvalupdate,
+		InsertValue:       insertvalue,
 		CurrentInsertStmt: insertstmt,
 	}
+	err = table.attach(ctx, db)
+	if err != nil {
+		return &Table{}, err
+	}
+	return table, nil
+}
+
+// returns the column type for a column read from information_schema
+// user defined types are told apart by their udt name
+func readColumnType(datatype string, udtname string) ColumnType {
+	switch udtname {
+	case "geometry":
+		return Geometry
+	case "hstore":
+		return HStore
+	case "jsonb":
+		return JSONB
+	}
+	if datatype == "ARRAY" {
+		return ArrayOf(ColumnType(strings.TrimPrefix(udtname, "_")))
+	}
+	return ColumnType(datatype)
 }
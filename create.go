@@ -0,0 +1,147 @@
+package pgpush
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// how CreateTable handles a table that already exists
+type CreateMode int
+
+const (
+	CreateFail     CreateMode = iota // returns the create error
+	CreateAppend                     // appends to it once its columns are checked
+	CreateTruncate                   // truncates it once its columns are checked
+	CreateDrop                       // drops and recreates it
+)
+
+// returned when an existing table's columns don't match the table's
+var ErrSchemaMismatch = errors.New("existing table doesn't match the columns")
+
+// the udt name postgres reports for each column type
+var udtNames = map[ColumnType]string{
+	SmallInt: "int2",
+	Integer:  "int4",
+	BigInt:   "int8",
+
+	Decimal: "numeric",
+	Numeric: "numeric",
+	Real:    "float4",
+	Double:  "float8",
+
+	SmallSerial: "int2",
+	Serial:      "int4",
+	BigSerial:   "int8",
+
+	VarChar: "varchar",
+	Char:    "bpchar",
+	Text:    "text",
+	UUID:    "uuid",
+
+	Bytea: "bytea",
+
+	TimestampWithoutTimezone: "timestamp",
+	TimestampWithTimezone:    "timestamptz",
+	Date:                     "date",
+	TimeWithoutTimezone:      "time",
+	TimeWithTimezone:         "timetz",
+	Interval:                 "interval",
+
+	Boolean: "bool",
+
+	Geometry: "geometry",
+
+	HStore: "hstore",
+
+	JSONB: "jsonb",
+}
+
+// reads the columns of an existing table from information_schema
+// along with the udt name of each, ErrTableNotFound if there are none
+func readColumns(ctx context.Context, tablename string, db DB) ([]Column, map[string]string, error) {
+	schema, name := SplitTableName(tablename)
+	result, err := db.QueryEx(ctx, "select column_name, data_type, udt_name from INFORMATION_SCHEMA.COLUMNS where "+tableFilter+" order by ordinal_position;", nil, name, schema)
+	if err != nil {
+		return nil, nil, newTableError(tablename, OpQuery, err)
+	}
+	defer result.Close()
+
+	columns := []Column{}
+	udtnames := map[string]string{}
+	for result.Next() {
+		var key, typeval, udtname string
+		err = result.Scan(&key, &typeval, &udtname)
+		if err != nil {
+			return nil, nil, newTableError(tablename, OpQuery, err)
+		}
+		columns = append(columns, Column{Name: key, Type: readColumnType(typeval, udtname)})
+		udtnames[key] = udtname
+	}
+	if result.Err() != nil {
+		return nil, nil, newTableError(tablename, OpQuery, result.Err())
+	}
+	if len(columns) == 0 {
+		return nil, nil, newTableError(tablename, OpQuery, ErrTableNotFound)
+	}
+	return columns, udtnames, nil
+}
+
+// checks every column of the table exists in the existing table
+// with the same type, types without a known udt name only need to exist
+func (table *Table) validateColumns(udtnames map[string]string) error {
+	for _, column := range table.Columns {
+		udtname, boolval := udtnames[column.Name]
+		if !boolval {
+			return newTableError(table.TableName, OpCreate, fmt.Errorf("%w: column %q is missing", ErrSchemaMismatch, column.Name))
+		}
+		want, boolval := column.Type.udtName()
+		if boolval && want != udtname {
+			return newTableError(table.TableName, OpCreate, fmt.Errorf("%w: column %q is %s not %s", ErrSchemaMismatch, column.Name, udtname, want))
+		}
+	}
+	return nil
+}
+
+// prepares an existing table for the create mode, returning whether
+// the table still has to be created
+func (table *Table) prepare(ctx context.Context, db DB, mode CreateMode) (bool, error) {
+	switch mode {
+	case CreateDrop:
+		_, err := db.ExecEx(ctx, "DROP TABLE IF EXISTS "+QuoteTableName(table.TableName)+";", nil)
+		if err != nil {
+			return false, newTableError(table.TableName, OpCreate, err)
+		}
+		return true, nil
+	case CreateAppend, CreateTruncate:
+		_, udtnames, err := readColumns(ctx, table.TableName, db)
+		if errors.Is(err, ErrTableNotFound) {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+		err = table.validateColumns(udtnames)
+		if err != nil {
+			return false, err
+		}
+		if mode == CreateTruncate {
+			_, err = db.ExecEx(ctx, "TRUNCATE TABLE "+QuoteTableName(table.TableName)+";", nil)
+			if err != nil {
+				return false, newTableError(table.TableName, OpCreate, err)
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// returns the udt name postgres reports for the column type
+// ignoring any length or precision
+func (columntype ColumnType) udtName() (string, bool) {
+	if columntype.Category() == "array" {
+		udtname, boolval := columntype.Element().udtName()
+		return "_" + udtname, boolval
+	}
+	udtname, boolval := udtNames[columntype.Base()]
+	return udtname, boolval
+}
@@ -0,0 +1,35 @@
+package pgpush
+
+import (
+	"testing"
+)
+
+func TestUdtName(t *testing.T) {
+	tests := []struct {
+		columntype ColumnType
+		want       string
+	}{
+		{Integer, "int4"},
+		{Double, "float8"},
+		{Real, "float4"},
+		{UUID, "uuid"},
+		{Text, "text"},
+		{VarCharN(20), "varchar"},
+		{CharN(2), "bpchar"},
+		{NumericPS(10, 2), "numeric"},
+		{TimestampWithTimezone, "timestamptz"},
+		{ArrayOf(Integer), "_int4"},
+		{ArrayOf(Double), "_float8"},
+		{ArrayOf(VarCharN(5)), "_varchar"},
+		{TextArray, "_text"},
+		{JSONB, "jsonb"},
+		{HStore, "hstore"},
+		{Geometry, "geometry"},
+	}
+	for _, test := range tests {
+		got, boolval := test.columntype.udtName()
+		if !boolval || got != test.want {
+			t.Errorf("%s udtName() = %q, %v, want %q", test.columntype, got, boolval, test.want)
+		}
+	}
+}
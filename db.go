@@ -0,0 +1,46 @@
+package pgpush
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx"
+	"time"
+)
+
+// a connection statements can be run on
+// *pgx.ConnPool, *pgx.Conn and *pgx.Tx all satisfy it
+//
+// a table given a pool or connection begins and commits its own
+// transactions on it but never closes it
+// a table given a transaction inserts within it and leaves committing
+// or rolling it back to the caller, Commit only flushes the current
+// batch and Rollback only discards it
+type DB interface {
+	ExecEx(ctx context.Context, sql string, options *pgx.QueryExOptions, arguments ...interface{}) (pgx.CommandTag, error)
+	QueryEx(ctx context.Context, sql string, options *pgx.QueryExOptions, args ...interface{}) (*pgx.Rows, error)
+}
+
+// a DB transactions can be started on, *pgx.ConnPool and *pgx.Conn
+type Beginner interface {
+	DB
+	BeginEx(ctx context.Context, txOptions *pgx.TxOptions) (*pgx.Tx, error)
+}
+
+// attaches the table to the given DB beginning a transaction
+// on it unless it is one
+func (table *Table) attach(ctx context.Context, db DB) error {
+	switch db := db.(type) {
+	case *pgx.Tx:
+		table.Tx = db
+		table.externalTx = true
+		table.TxStarted = time.Now()
+		return nil
+	case Beginner:
+		table.beginner = db
+		if p, boolval := db.(*pgx.ConnPool); boolval {
+			table.Conn = p
+		}
+		return table.ensureTx(ctx)
+	}
+	return errors.New("pgpush: DB must be a *pgx.Tx or be able to begin transactions")
+}
@@ -0,0 +1,135 @@
+package pgpush
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx"
+	"github.com/paulmach/go.geojson"
+	"os"
+	"sync"
+)
+
+// a sink for features a table couldn't insert
+// i.e. invalid geometries, values that can't be converted
+// or features in a batch the database refused
+type DeadLetter interface {
+	WriteRejected(tablename string, feature *geojson.Feature, reason error) error
+}
+
+// a rejected feature as written to a GeoJSONSeq dead letter file
+// the feature keeps its original properties, the table and reason
+// are added as foreign members
+type RejectedFeature struct {
+	ID         interface{}            `json:"id,omitempty"`
+	Type       string                 `json:"type"`
+	Geometry   *geojson.Geometry      `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+	Table      string                 `json:"table"`
+	Reason     string                 `json:"reason"`
+}
+
+// writes rejected features to a GeoJSONSeq (RFC 8142) file
+type GeoJSONSeqDeadLetter struct {
+	Filename string
+	file     *os.File
+	writer   *bufio.Writer
+	mutex    sync.Mutex
+}
+
+// opens a GeoJSONSeq dead letter file appending to it if it exists
+func NewGeoJSONSeqDeadLetter(filename string) (*GeoJSONSeqDeadLetter, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoJSONSeqDeadLetter{Filename: filename, file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// writes a rejected feature as a record separator prefixed line
+func (deadletter *GeoJSONSeqDeadLetter) WriteRejected(tablename string, feature *geojson.Feature, reason error) error {
+	bytevals, err := json.Marshal(RejectedFeature{
+		ID:         feature.ID,
+		Type:       "Feature",
+		Geometry:   feature.Geometry,
+		Properties: feature.Properties,
+		Table:      tablename,
+		Reason:     reason.Error(),
+	})
+	if err != nil {
+		return err
+	}
+
+	deadletter.mutex.Lock()
+	defer deadletter.mutex.Unlock()
+	err = deadletter.writer.WriteByte(0x1e)
+	if err != nil {
+		return err
+	}
+	_, err = deadletter.writer.Write(bytevals)
+	if err != nil {
+		return err
+	}
+	return deadletter.writer.WriteByte('\n')
+}
+
+// flushes and closes the dead letter file
+func (deadletter *GeoJSONSeqDeadLetter) Close() error {
+	deadletter.mutex.Lock()
+	defer deadletter.mutex.Unlock()
+	err := deadletter.writer.Flush()
+	if err != nil {
+		deadletter.file.Close()
+		return err
+	}
+	return deadletter.file.Close()
+}
+
+// writes rejected features to a side table outside of the
+// transaction of the table that rejected them
+type TableDeadLetter struct {
+	TableName string
+	Conn      *pgx.ConnPool
+}
+
+// creates the dead letter table if it doesn't exist
+func NewTableDeadLetter(tablename string, p *pgx.ConnPool) (*TableDeadLetter, error) {
+	createstmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id bigserial primary key,
+	table_name text,
+	reason text,
+	feature jsonb,
+	created_at timestamptz default now()
+);`, QuoteTableName(tablename))
+	_, err := p.Exec(createstmt)
+	if err != nil {
+		return nil, newTableError(tablename, OpCreate, err)
+	}
+	return &TableDeadLetter{TableName: tablename, Conn: p}, nil
+}
+
+// inserts a rejected feature into the dead letter table
+func (deadletter *TableDeadLetter) WriteRejected(tablename string, feature *geojson.Feature, reason error) error {
+	bytevals, err := json.Marshal(feature)
+	if err != nil {
+		return err
+	}
+	insertstmt := fmt.Sprintf("INSERT INTO %s (table_name, reason, feature) VALUES ($1, $2, $3)", QuoteTableName(deadletter.TableName))
+	_, err = deadletter.Conn.ExecEx(context.Background(), insertstmt, nil, tablename, reason.Error(), string(bytevals))
+	if err != nil {
+		return newTableError(deadletter.TableName, OpInsert, err)
+	}
+	return nil
+}
+
+// sends a rejected feature to the table's dead letter if it has one
+func (table *Table) deadLetter(feature *geojson.Feature, reason error) {
+	if table.DeadLetter == nil {
+		return
+	}
+	err := table.DeadLetter.WriteRejected(table.TableName, feature, reason)
+	if err != nil {
+		table.logger().Error("dead letter write failed", "table", table.TableName, "error", err)
+	}
+}
@@ -0,0 +1,103 @@
+package pgpush
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx"
+	"github.com/paulmach/go.geojson"
+)
+
+// the operations a TableError can come from
+const (
+	OpCreate = "create"
+	OpInsert = "insert"
+	OpCommit = "commit"
+	OpQuery  = "query"
+)
+
+// returned for any geometry the wkb encoder can't write
+var ErrUnsupportedGeometry = errors.New("unsupported geometry type")
+
+// returned when reading a table that doesn't exist
+var ErrTableNotFound = errors.New("table does not exist")
+
+// returned by a table's methods after it's closed
+var ErrTableClosed = errors.New("pgpush: table is closed")
+
+// an error from a statement run against a table
+// for inserts and commits First and Last give the range of feature
+// indexes (in the order they were added) that didn't make it in,
+// the whole range since the last commit when the transaction was
+// rolled back
+type TableError struct {
+	TableName string
+	Op        string
+	First     int
+	Last      int
+	SQLState  string
+	Err       error
+}
+
+func (e *TableError) Error() string {
+	msg := fmt.Sprintf("pgpush: %s %s", e.Op, e.TableName)
+	if e.Op == OpInsert || e.Op == OpCommit {
+		msg += fmt.Sprintf(" features %d-%d", e.First, e.Last)
+	}
+	msg += ": " + e.Err.Error()
+	return msg
+}
+
+func (e *TableError) Unwrap() error {
+	return e.Err
+}
+
+// returned by AddFeature for a feature it refuses to insert
+type RejectError struct {
+	Err error
+}
+
+func (e *RejectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectError) Unwrap() error {
+	return e.Err
+}
+
+// a row of a batch that failed to insert on its own
+type RowError struct {
+	Index   int // the feature's index in the order they were added
+	Feature *geojson.Feature
+	Err     error
+}
+
+// returned when rows of a batch failed while the transaction stayed
+// intact, with IsolateFailures only the bad rows fail and the rest
+// of the batch is inserted otherwise it's every row of the batch
+type BatchError struct {
+	TableName string
+	Rows      []RowError
+}
+
+// unwraps to each row's error so errors.As finds their TableErrors
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Rows))
+	for pos, row := range e.Rows {
+		errs[pos] = row.Err
+	}
+	return errs
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("pgpush: %s %s: %d features failed, feature %d: %v", OpInsert, e.TableName, len(e.Rows), e.Rows[0].Index, e.Rows[0].Err)
+}
+
+// creates a table error pulling the sql state out of postgres errors
+func newTableError(tablename string, op string, err error) *TableError {
+	tableerr := &TableError{TableName: tablename, Op: op, Err: err}
+	pgerr, boolval := err.(pgx.PgError)
+	if boolval {
+		tableerr.SQLState = pgerr.Code
+	}
+	return tableerr
+}
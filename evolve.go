@@ -0,0 +1,141 @@
+package pgpush
+
+import (
+	"context"
+	"fmt"
+	"github.com/paulmach/go.geojson"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// infers the column type for a new property value
+// numbers decoded from json are float64 so they become numeric
+// which holds whole numbers as well
+func InferColumnType(value interface{}) ColumnType {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return JSONB
+	case time.Time:
+		return TimestampWithTimezone
+	case []string:
+		return TextArray
+	case []float64:
+		return ArrayOf(Numeric)
+	case []bool:
+		return ArrayOf(Boolean)
+	}
+	_, typeval := ParseValue(value)
+	switch typeval {
+	case "int":
+		return BigInt
+	case "float":
+		return Numeric
+	case "bool":
+		return Boolean
+	}
+	return Text
+}
+
+// builds the insert statement and the insert value for a set of columns
+// geometry columns get the wkb conversion to their srid
+func insertStatements(tablename string, columns []Column) (string, string) {
+	column_names := make([]string, len(columns))
+	insertlist := make([]string, len(columns))
+	for pos, column := range columns {
+		column_names[pos] = QuoteIdentifier(column.Name)
+		if column.Type != Geometry {
+			insertlist[pos] = "$%d"
+			continue
+		}
+		if column.GivenSRID == 0 {
+			column.GivenSRID = DefaultSRID
+		}
+		if column.TargetSRID == 0 {
+			column.TargetSRID = DefaultSRID
+		}
+		if column.GivenSRID != column.TargetSRID {
+			insertlist[pos] = "ST_Transform(ST_GeomFromWKB($%d," + strconv.Itoa(column.GivenSRID) + ")," + strconv.Itoa(column.TargetSRID) + ")"
+		} else {
+			insertlist[pos] = "ST_GeomFromWKB($%d," + strconv.Itoa(column.GivenSRID) + ")"
+		}
+	}
+	insertstmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", QuoteTableName(tablename), strings.Join(column_names, ", "))
+	insertvalue := fmt.Sprintf("(%s), ", strings.Join(insertlist, ","))
+	return insertstmt, insertvalue
+}
+
+// returns a column for every property of the feature the table
+// doesn't have yet, nil values are skipped until a value the type
+// can be inferred from shows up and properties already going into
+// the hstore columns are left there
+func (table *Table) newColumns(feature *geojson.Feature) []Column {
+	keys := []string{}
+	for k, v := range feature.Properties {
+		if v != nil && !table.HasColumn(k) && !table.inHStore(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	columns := make([]Column, len(keys))
+	for pos, k := range keys {
+		columns[pos] = Column{Name: k, Type: InferColumnType(feature.Properties[k])}
+	}
+	return columns
+}
+
+// adds the given columns to the table, the current batch is flushed
+// first as its rows were built for the old columns, a partial failure
+// of that flush is returned as a BatchError after the columns are added
+// the ALTER TABLE runs in the table's transaction so a rollback drops
+// the columns again, but its ACCESS EXCLUSIVE lock is held until the
+// next commit and blocks every other reader and writer of the table
+func (table *Table) evolve(ctx context.Context, added []Column) error {
+	batcherr := table.FlushContext(ctx)
+	_, partial := batcherr.(*BatchError)
+	if batcherr != nil && !partial {
+		return batcherr
+	}
+	err := table.ensureTx(ctx)
+	if err != nil {
+		return newTableError(table.TableName, OpCreate, err)
+	}
+
+	// the columns are added in the table's transaction so a rollback
+	// takes them back to the ones of the last commit, a transaction the
+	// table was given is never rolled back by it so nothing is kept
+	if table.committedColumns == nil && !table.externalTx {
+		table.committedColumns = table.Columns
+	}
+	columns := append([]Column{}, table.Columns...)
+	for _, column := range added {
+		alterstmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;", QuoteTableName(table.TableName), QuoteIdentifier(column.Name), string(column.Type))
+		_, err = table.Tx.ExecEx(ctx, alterstmt, nil)
+		if err != nil {
+			return table.abort(newTableError(table.TableName, OpCreate, err))
+		}
+		columns = append(columns, column)
+		table.logger().Info("column added", "table", table.TableName, "column", column.Name, "type", string(column.Type))
+	}
+	table.setColumns(columns)
+	return batcherr
+}
+
+// sets the table's columns regenerating its insert statement
+func (table *Table) setColumns(columns []Column) {
+	table.Columns = columns
+	table.InsertStmt, table.InsertValue = insertStatements(table.TableName, columns)
+	table.CurrentInsertStmt = table.InsertStmt
+	table.fullStmt = ""
+}
+
+// returns whether a property is one of the table's hstore columns
+func (table *Table) inHStore(name string) bool {
+	for _, k := range table.HStoreColumns {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
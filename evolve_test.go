@@ -0,0 +1,43 @@
+package pgpush
+
+import (
+	"context"
+	"github.com/paulmach/go.geojson"
+	"testing"
+)
+
+func TestNewColumns(t *testing.T) {
+	table := NewTable("evolve", []Column{{Name: "geometry", Type: Geometry}, {Name: "name", Type: Text}})
+	feature := geojson.NewPointFeature([]float64{1, 2})
+	feature.Properties = map[string]interface{}{"name": "a", "height": 2.5, "open": true, "missing": nil, "tags": map[string]interface{}{"a": "b"}}
+
+	columns := table.newColumns(feature)
+	want := []Column{{Name: "height", Type: Numeric}, {Name: "open", Type: Boolean}, {Name: "tags", Type: JSONB}}
+	if len(columns) != len(want) {
+		t.Fatalf("newColumns = %v, want %v", columns, want)
+	}
+	for pos := range want {
+		if columns[pos] != want[pos] {
+			t.Errorf("newColumns[%d] = %v, want %v", pos, columns[pos], want[pos])
+		}
+	}
+}
+
+// a feature rejected for one of its values mustn't alter the table
+func TestEvolveRejectsBeforeAlter(t *testing.T) {
+	table := NewTable("evolve", []Column{{Name: "geometry", Type: Geometry}, {Name: "day", Type: Date}})
+	table.EvolveSchema = true
+	feature := geojson.NewPointFeature([]float64{1, 2})
+	feature.Properties = map[string]interface{}{"day": "not a date", "extra": 5.0}
+
+	err := table.AddFeatureContext(context.Background(), feature)
+	if _, boolval := err.(*RejectError); !boolval {
+		t.Fatalf("AddFeatureContext error = %v, want a RejectError", err)
+	}
+	if len(table.Columns) != 2 || table.HasColumn("extra") {
+		t.Errorf("columns = %v, want the original two", table.Columns)
+	}
+	if table.Tx != nil || table.Count != 0 {
+		t.Errorf("table altered or batched after a rejected feature")
+	}
+}
@@ -0,0 +1,174 @@
+package pgpush
+
+import (
+	"encoding/json"
+	"github.com/paulmach/go.geojson"
+	"reflect"
+	"sort"
+)
+
+// how flattening writes array values
+type ArrayMode int
+
+const (
+	ArraysAsJSON  ArrayMode = iota // arrays are kept for jsonb columns or written as json text
+	ArraysAsArray                  // arrays of strings, numbers or bools become postgres arrays
+)
+
+// expands nested property objects into their own properties
+// i.e. {"addr": {"street": "Main"}} becomes {"addr_street": "Main"}
+type Flatten struct {
+	Separator string    // joins nested keys, "_" if empty
+	MaxDepth  int       // levels of objects expanded, 0 for all, deeper ones are kept whole
+	Arrays    ArrayMode // how arrays are written
+}
+
+// returns the properties with nested objects expanded
+// the properties given are left as is, when a flattened key collides
+// with another key the shallower one wins i.e. a literal "a_b" wins
+// over {"a": {"b": ...}}, ties go to the first nested key in order
+func FlattenProperties(properties map[string]interface{}, flatten Flatten) map[string]interface{} {
+	flattened := make(map[string]interface{}, len(properties))
+	flatten.expand(flattened, map[string]int{}, "", properties, 0)
+	return flattened
+}
+
+// adds the values of an object to the flattened properties under the prefix
+// depths holds the depth each flattened key was written from
+func (flatten Flatten) expand(flattened map[string]interface{}, depths map[string]int, prefix string, object map[string]interface{}, depth int) {
+	separator := flatten.Separator
+	if separator == "" {
+		separator = "_"
+	}
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := object[k]
+		key := k
+		if prefix != "" {
+			key = prefix + separator + k
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if flatten.MaxDepth == 0 || depth < flatten.MaxDepth {
+				flatten.expand(flattened, depths, key, v, depth+1)
+				continue
+			}
+		case []interface{}:
+			if flatten.Arrays == ArraysAsArray {
+				flatten.set(flattened, depths, key, typedArray(v), depth)
+				continue
+			}
+		}
+		flatten.set(flattened, depths, key, v, depth)
+	}
+}
+
+// writes a flattened value unless a shallower or earlier key holds it
+func (flatten Flatten) set(flattened map[string]interface{}, depths map[string]int, key string, value interface{}, depth int) {
+	existing, boolval := depths[key]
+	if boolval && existing <= depth {
+		return
+	}
+	depths[key] = depth
+	flattened[key] = value
+}
+
+// converts an array of strings, numbers or bools into a typed slice
+// so it's inferred and written as a postgres array, anything else
+// (mixed types, nulls or nested values) is returned as is
+func typedArray(values []interface{}) interface{} {
+	if len(values) == 0 {
+		return values
+	}
+	switch values[0].(type) {
+	case string:
+		array := make([]string, len(values))
+		for pos, v := range values {
+			val, boolval := v.(string)
+			if !boolval {
+				return values
+			}
+			array[pos] = val
+		}
+		return array
+	case float64:
+		array := make([]float64, len(values))
+		for pos, v := range values {
+			val, boolval := v.(float64)
+			if !boolval {
+				return values
+			}
+			array[pos] = val
+		}
+		return array
+	case bool:
+		array := make([]bool, len(values))
+		for pos, v := range values {
+			val, boolval := v.(bool)
+			if !boolval {
+				return values
+			}
+			array[pos] = val
+		}
+		return array
+	}
+	return values
+}
+
+// returns the text written for a property in a plain column
+// objects and arrays are written as json instead of go syntax
+// and floats without an exponent like array elements are,
+// bytes are passed through unchanged
+func propertyText(value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return value, nil
+	case []byte:
+		// bytes go to bytea columns as they are
+		return value, nil
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		bytevals, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(bytevals), nil
+	}
+	return formatScalar(value), nil
+}
+
+// infers the columns for a sample of features from the first non nil
+// value of each property, flattened if given, with a geometry column last
+func InferColumns(features []*geojson.Feature, flatten *Flatten) []Column {
+	types := map[string]ColumnType{}
+	for _, feature := range features {
+		properties := feature.Properties
+		if flatten != nil {
+			properties = FlattenProperties(properties, *flatten)
+		}
+		for k, v := range properties {
+			_, exists := types[k]
+			if !exists && v != nil {
+				types[k] = InferColumnType(v)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(types))
+	for k := range types {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	columns := make([]Column, 0, len(names)+1)
+	for _, name := range names {
+		columns = append(columns, Column{Name: name, Type: types[name], KeepColumn: true})
+	}
+	return append(columns, Column{Name: "geometry", Type: Geometry})
+}
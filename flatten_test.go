@@ -0,0 +1,89 @@
+package pgpush
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPropertyText(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{nil, nil},
+		{"text", "text"},
+		{1e6, "1000000"},
+		{1.5, "1.5"},
+		{0.000001, "0.000001"},
+		{float32(0.1), "0.1"},
+		{true, "true"},
+		{42, "42"},
+		{map[string]interface{}{"a": 1.0}, `{"a":1}`},
+		{[]interface{}{"a", 1e6}, `["a",1000000]`},
+		{[]string{"a", "b"}, `["a","b"]`},
+		{[]int{1, 2}, `[1,2]`},
+	}
+	for _, test := range tests {
+		got, err := propertyText(test.value)
+		if err != nil {
+			t.Errorf("propertyText(%v) error: %v", test.value, err)
+		} else if got != test.want {
+			t.Errorf("propertyText(%v) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+// a float flattened into an array column is written the same
+// as the float in a plain column
+func TestTypedArrayAgrees(t *testing.T) {
+	values := []interface{}{1e6, 2.5, 0.000001}
+	array := typedArray(values)
+	if _, boolval := array.([]float64); !boolval {
+		t.Fatalf("typedArray(%v) = %T, want []float64", values, array)
+	}
+	got, err := EncodeArray(array)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{"
+	for pos, v := range values {
+		text, _ := propertyText(v)
+		if pos > 0 {
+			want += ","
+		}
+		want += QuoteArrayElement(text.(string))
+	}
+	want += "}"
+	if got != want {
+		t.Errorf("EncodeArray(typedArray(%v)) = %v, want %v", values, got, want)
+	}
+}
+
+// colliding keys flatten the same way whatever the map order
+func TestFlattenCollisions(t *testing.T) {
+	tests := []struct {
+		properties map[string]interface{}
+		want       map[string]interface{}
+	}{
+		{
+			map[string]interface{}{"a_b": 1.0, "a": map[string]interface{}{"b": 2.0}},
+			map[string]interface{}{"a_b": 1.0},
+		},
+		{
+			map[string]interface{}{"a": map[string]interface{}{"b_c": 1.0, "b": map[string]interface{}{"c": 2.0}}},
+			map[string]interface{}{"a_b_c": 1.0},
+		},
+		{
+			map[string]interface{}{"a": map[string]interface{}{"b_c": 1.0}, "a_b": map[string]interface{}{"c": 2.0}},
+			map[string]interface{}{"a_b_c": 1.0},
+		},
+	}
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			got := FlattenProperties(test.properties, Flatten{})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("FlattenProperties(%v) = %v, want %v", test.properties, got, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package pgpush
+
+import (
+	"fmt"
+	"github.com/jackc/pgx/pgtype"
+	"github.com/paulmach/go.geojson"
+)
+
+// returns the hstore text for a property value
+// nil values become NULL, objects and arrays are written as json
+// and floats without an exponent
+func HStoreText(value interface{}) pgtype.Text {
+	val, err := propertyText(value)
+	if err != nil {
+		return pgtype.Text{String: fmt.Sprint(value), Status: pgtype.Present}
+	}
+	switch val := val.(type) {
+	case string:
+		return pgtype.Text{String: val, Status: pgtype.Present}
+	case []byte:
+		return pgtype.Text{String: string(val), Status: pgtype.Present}
+	}
+	return pgtype.Text{Status: pgtype.Null}
+}
+
+// creates a native hstore value from a map of tags
+func NewHStore(tags map[string]interface{}) *pgtype.Hstore {
+	hstore := &pgtype.Hstore{Map: make(map[string]pgtype.Text, len(tags)), Status: pgtype.Present}
+	for k, v := range tags {
+		hstore.Map[k] = HStoreText(v)
+	}
+	return hstore
+}
+
+// creates the hstore value for a feature
+// a prebuilt tag map under the hstore column's name is used as is
+// otherwise the tags are collected from the hstore columns and
+// with DynamicHStore from every property that doesn't have a column
+func (table *Table) HStoreValue(column Column, feature *geojson.Feature) *pgtype.Hstore {
+	tags, boolval := feature.Properties[column.Name].(map[string]string)
+	if boolval {
+		hstore := &pgtype.Hstore{}
+		hstore.Set(tags)
+		return hstore
+	}
+
+	values := map[string]interface{}{}
+	for _, name := range table.HStoreColumns {
+		val, boolval := feature.Properties[name]
+		if !boolval && table.HStoreOmitMissing {
+			continue
+		}
+		values[name] = val
+	}
+
+	if table.DynamicHStore {
+		for k, v := range feature.Properties {
+			if !table.HasColumn(k) {
+				values[k] = v
+			}
+		}
+	}
+	return NewHStore(values)
+}
+
+// returns whether the table has a column for the given name
+func (table *Table) HasColumn(name string) bool {
+	for _, column := range table.Columns {
+		if column.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// converts a value read from an hstore column into properties
+// NULL values become nil
+func HStoreProperties(value interface{}) (map[string]interface{}, error) {
+	var tags map[string]pgtype.Text
+	switch value := value.(type) {
+	case map[string]pgtype.Text:
+		tags = value
+	case map[string]string:
+		properties := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			properties[k] = v
+		}
+		return properties, nil
+	case string:
+		hstore := &pgtype.Hstore{}
+		err := hstore.DecodeText(nil, []byte(value))
+		if err != nil {
+			return nil, err
+		}
+		tags = hstore.Map
+	default:
+		return nil, fmt.Errorf("cannot convert %T to hstore properties", value)
+	}
+
+	properties := make(map[string]interface{}, len(tags))
+	for k, v := range tags {
+		if v.Status == pgtype.Present {
+			properties[k] = v.String
+		} else {
+			properties[k] = nil
+		}
+	}
+	return properties, nil
+}
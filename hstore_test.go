@@ -0,0 +1,162 @@
+package pgpush
+
+import (
+	"github.com/jackc/pgx/pgtype"
+	"github.com/paulmach/go.geojson"
+	"reflect"
+	"testing"
+)
+
+func TestHStoreText(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  pgtype.Text
+	}{
+		{nil, pgtype.Text{Status: pgtype.Null}},
+		{"road", pgtype.Text{String: "road", Status: pgtype.Present}},
+		{1e6, pgtype.Text{String: "1000000", Status: pgtype.Present}},
+		{false, pgtype.Text{String: "false", Status: pgtype.Present}},
+		{map[string]interface{}{"lanes": 2.0}, pgtype.Text{String: `{"lanes":2}`, Status: pgtype.Present}},
+		{[]interface{}{"a", nil}, pgtype.Text{String: `["a",null]`, Status: pgtype.Present}},
+	}
+	for _, test := range tests {
+		got := HStoreText(test.value)
+		if got != test.want {
+			t.Errorf("HStoreText(%v) = %+v, want %+v", test.value, got, test.want)
+		}
+	}
+}
+
+// tags keep their quotes and backslashes through the binary encoding
+// the hstore is sent with and nil tags are NULL
+func TestNewHStoreEscaping(t *testing.T) {
+	tags := map[string]interface{}{
+		`say "hi"`:   `she said "hi"`,
+		`back\slash`: `C:\path\`,
+		"mixed":      `\"`,
+		"=>":         ", ",
+	}
+	hstore := NewHStore(tags)
+	bytevals, err := hstore.EncodeBinary(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &pgtype.Hstore{}
+	err = decoded.DecodeBinary(nil, bytevals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := HStoreProperties(decoded.Map)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, tags) {
+		t.Errorf("decoded %v, want %v", got, tags)
+	}
+
+	// pgtype can't decode a binary NULL value so it's only checked encoded
+	hstore = NewHStore(map[string]interface{}{"empty": nil})
+	if hstore.Map["empty"].Status != pgtype.Null {
+		t.Errorf("nil tag = %+v, want NULL", hstore.Map["empty"])
+	}
+}
+
+// hstore text read back the way postgres writes it
+func TestHStorePropertiesText(t *testing.T) {
+	got, err := HStoreProperties(`"say \"hi\""=>"C:\\path", "empty"=>NULL`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{`say "hi"`: `C:\path`, "empty": nil}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HStoreProperties = %v, want %v", got, want)
+	}
+}
+
+// a table folding its name and ref columns into the tags hstore
+func newHStoreTable() *Table {
+	return NewTable("hstores", []Column{
+		{Name: "name", Type: Text},
+		{Name: "ref", Type: Text},
+		{Name: "tags", Type: HStore},
+		{Name: "geometry", Type: Geometry},
+	})
+}
+
+func TestHStoreOmitMissing(t *testing.T) {
+	feature := geojson.NewPointFeature([]float64{1, 2})
+	feature.Properties["name"] = `a "b"`
+	tests := []struct {
+		omit bool
+		want map[string]pgtype.Text
+	}{
+		{false, map[string]pgtype.Text{
+			"name": {String: `a "b"`, Status: pgtype.Present},
+			"ref":  {Status: pgtype.Null},
+		}},
+		{true, map[string]pgtype.Text{
+			"name": {String: `a "b"`, Status: pgtype.Present},
+		}},
+	}
+	for _, test := range tests {
+		table := newHStoreTable()
+		table.HStoreOmitMissing = test.omit
+		got := table.HStoreValue(Column{Name: "tags", Type: HStore}, feature)
+		if !reflect.DeepEqual(got.Map, test.want) {
+			t.Errorf("HStoreValue with HStoreOmitMissing %v = %v, want %v", test.omit, got.Map, test.want)
+		}
+	}
+}
+
+func TestDynamicHStore(t *testing.T) {
+	feature := geojson.NewPointFeature([]float64{1, 2})
+	feature.Properties["name"] = "a"
+	feature.Properties["surface"] = "paved"
+	feature.Properties["lanes"] = 2.0
+	feature.Properties["note"] = nil
+	tests := []struct {
+		omit bool
+		want map[string]pgtype.Text
+	}{
+		{false, map[string]pgtype.Text{
+			"name":    {String: "a", Status: pgtype.Present},
+			"ref":     {Status: pgtype.Null},
+			"surface": {String: "paved", Status: pgtype.Present},
+			"lanes":   {String: "2", Status: pgtype.Present},
+			"note":    {Status: pgtype.Null},
+		}},
+		// only missing properties are left out, a nil one is still NULL
+		{true, map[string]pgtype.Text{
+			"name":    {String: "a", Status: pgtype.Present},
+			"surface": {String: "paved", Status: pgtype.Present},
+			"lanes":   {String: "2", Status: pgtype.Present},
+			"note":    {Status: pgtype.Null},
+		}},
+	}
+	for _, test := range tests {
+		table := newHStoreTable()
+		table.DynamicHStore = true
+		table.HStoreOmitMissing = test.omit
+		got := table.HStoreValue(Column{Name: "tags", Type: HStore}, feature)
+		if !reflect.DeepEqual(got.Map, test.want) {
+			t.Errorf("dynamic HStoreValue with HStoreOmitMissing %v = %v, want %v", test.omit, got.Map, test.want)
+		}
+	}
+}
+
+// a prebuilt tag map under the hstore column's name is used as is
+func TestHStoreValuePrebuilt(t *testing.T) {
+	feature := geojson.NewPointFeature([]float64{1, 2})
+	feature.Properties["tags"] = map[string]string{"highway": "primary", "quote": `a"b`}
+	feature.Properties["name"] = "a"
+	table := newHStoreTable()
+	table.DynamicHStore = true
+	got := table.HStoreValue(Column{Name: "tags", Type: HStore}, feature)
+	want := map[string]pgtype.Text{
+		"highway": {String: "primary", Status: pgtype.Present},
+		"quote":   {String: `a"b`, Status: pgtype.Present},
+	}
+	if got.Status != pgtype.Present || !reflect.DeepEqual(got.Map, want) {
+		t.Errorf("HStoreValue = %+v, want %v", got, want)
+	}
+}
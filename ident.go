@@ -0,0 +1,80 @@
+package pgpush
+
+import (
+	"github.com/jackc/pgx"
+	"strings"
+)
+
+// quotes a column or other single identifier for use in a statement
+func QuoteIdentifier(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// quotes a table name for use in a statement
+// a name like "schema.table" is treated as schema qualified,
+// see SplitTableName for quoting names that contain dots
+func QuoteTableName(tablename string) string {
+	schema, name := SplitTableName(tablename)
+	if schema == "" {
+		return pgx.Identifier{name}.Sanitize()
+	}
+	return pgx.Identifier{schema, name}.Sanitize()
+}
+
+// the schema unqualified table names are created in and read from
+// left empty they follow the connection's search path
+var DefaultSchema = ""
+
+// splits a possibly schema qualified table name into its schema
+// and name, an unqualified name gets the DefaultSchema
+// either part can be double quoted like "schema"."na.me" so
+// names containing dots can be addressed
+func SplitTableName(tablename string) (string, string) {
+	schema, n := readQuoted(tablename)
+	if n == 0 {
+		pos := strings.Index(tablename, ".")
+		if pos == -1 {
+			return DefaultSchema, tablename
+		}
+		schema, n = tablename[:pos], pos
+	}
+	if n == len(tablename) {
+		return DefaultSchema, schema
+	}
+	// anything following a quoted part other than a dot
+	// isn't a quoted name so it's kept as given
+	if tablename[n] != '.' {
+		return DefaultSchema, tablename
+	}
+	rest := tablename[n+1:]
+	name, n := readQuoted(rest)
+	if n != len(rest) {
+		name = rest
+	}
+	return schema, name
+}
+
+// reads a double quoted identifier from the start of a string returning
+// it unquoted and the length it took, 0 if the string doesn't start with one
+func readQuoted(s string) (string, int) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", 0
+	}
+	var name strings.Builder
+	for pos := 1; pos < len(s); pos++ {
+		if s[pos] != '"' {
+			name.WriteByte(s[pos])
+		} else if pos+1 < len(s) && s[pos+1] == '"' {
+			name.WriteByte('"')
+			pos++
+		} else {
+			return name.String(), pos + 1
+		}
+	}
+	return "", 0
+}
+
+// the information_schema filter for a table, takes the name and schema
+// as $1 and $2 with an empty schema meaning the current schema so
+// same named tables in other schemas aren't picked up
+const tableFilter = "table_name = $1 and table_schema = coalesce(nullif($2, ''), current_schema())"
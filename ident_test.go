@@ -0,0 +1,48 @@
+package pgpush
+
+import (
+	"testing"
+)
+
+func TestSplitTableName(t *testing.T) {
+	tests := []struct {
+		tablename string
+		schema    string
+		name      string
+	}{
+		{"roads", "", "roads"},
+		{"osm.roads", "osm", "roads"},
+		{"osm.roads.2024", "osm", "roads.2024"},
+		{`"na.me"`, "", "na.me"},
+		{`osm."na.me"`, "osm", "na.me"},
+		{`"my.schema"."na.me"`, "my.schema", "na.me"},
+		{`"my.schema".roads`, "my.schema", "roads"},
+		{`"a""b"."c""d"`, `a"b`, `c"d`},
+		{`"unterminated.name`, `"unterminated`, "name"},
+		{`"quoted"suffix`, "", `"quoted"suffix`},
+	}
+	for _, test := range tests {
+		schema, name := SplitTableName(test.tablename)
+		if schema != test.schema || name != test.name {
+			t.Errorf("SplitTableName(%q) = %q, %q, want %q, %q", test.tablename, schema, name, test.schema, test.name)
+		}
+	}
+}
+
+func TestQuoteTableName(t *testing.T) {
+	tests := []struct {
+		tablename string
+		want      string
+	}{
+		{"roads", `"roads"`},
+		{"osm.roads", `"osm"."roads"`},
+		{`osm."na.me"`, `"osm"."na.me"`},
+		{`"a""b".c`, `"a""b"."c"`},
+	}
+	for _, test := range tests {
+		got := QuoteTableName(test.tablename)
+		if got != test.want {
+			t.Errorf("QuoteTableName(%q) = %s, want %s", test.tablename, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package pgpush
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/pgtype"
+	"github.com/paulmach/go.geojson"
+)
+
+// what a jsonb column stores for each feature
+type JSONBMode int
+
+const (
+	JSONBProperty           JSONBMode = iota // the property with the column's name
+	JSONBAllProperties                       // every property of the feature
+	JSONBUnmappedProperties                  // every property without a column
+)
+
+// creates the jsonb value for a feature based on the table's JSONBMode
+func (table *Table) JSONBValue(column Column, feature *geojson.Feature) (*pgtype.JSONB, error) {
+	var value interface{}
+	switch table.JSONBMode {
+	case JSONBProperty:
+		value = feature.Properties[column.Name]
+	case JSONBAllProperties:
+		value = feature.Properties
+	case JSONBUnmappedProperties:
+		properties := map[string]interface{}{}
+		for k, v := range feature.Properties {
+			if !table.HasColumn(k) {
+				properties[k] = v
+			}
+		}
+		value = properties
+	}
+
+	return newJSONB(value)
+}
+
+// marshals a value into a jsonb value, nil becomes NULL
+// pgtype.JSONB.Set would take strings and bytes as raw json text
+// so everything is marshalled here instead
+func newJSONB(value interface{}) (*pgtype.JSONB, error) {
+	if value == nil {
+		return &pgtype.JSONB{Status: pgtype.Null}, nil
+	}
+	bytevals, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &pgtype.JSONB{Bytes: bytevals, Status: pgtype.Present}, nil
+}
+
+// the comment marking a jsonb column as a catch-all for the exporters
+const catchAllComment = "pgpush:catch-all"
+
+// marks the table's CatchAll jsonb columns with a comment for the
+// exporters, only run while creating or opening the table for append
+// so inserting never needs to own the table, a column that already
+// has a comment keeps it
+func (table *Table) markCatchAll(ctx context.Context, db DB) error {
+	for _, column := range table.Columns {
+		if !column.CatchAll || column.Type.Category() != "jsonb" {
+			continue
+		}
+		rows, err := db.QueryEx(ctx, "select col_description(attrelid, attnum) from pg_attribute where attrelid = $1::regclass and attname = $2;", nil, QuoteTableName(table.TableName), column.Name)
+		if err != nil {
+			return err
+		}
+		var comment *string
+		for rows.Next() {
+			err = rows.Scan(&comment)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return rows.Err()
+		}
+		if comment != nil {
+			continue
+		}
+		commentstmt := fmt.Sprintf("COMMENT ON COLUMN %s.%s IS '%s';", QuoteTableName(table.TableName), QuoteIdentifier(column.Name), catchAllComment)
+		_, err = db.ExecEx(ctx, commentstmt, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
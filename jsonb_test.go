@@ -0,0 +1,49 @@
+package pgpush
+
+import (
+	"encoding/json"
+	"github.com/jackc/pgx/pgtype"
+	"github.com/paulmach/go.geojson"
+	"testing"
+)
+
+func TestJSONBValue(t *testing.T) {
+	table := NewTable("places", []Column{{Name: "geometry", Type: Geometry}, {Name: "name", Type: Text}, {Name: "data", Type: JSONB}})
+	tests := []struct {
+		mode  JSONBMode
+		value interface{}
+		want  string
+		null  bool
+	}{
+		{JSONBProperty, "hello", `"hello"`, false},
+		{JSONBProperty, `say "hi"`, `"say \"hi\""`, false},
+		{JSONBProperty, nil, "", true},
+		{JSONBProperty, 1e6, `1000000`, false},
+		{JSONBProperty, map[string]interface{}{"a": []interface{}{1.0, "b"}}, `{"a":[1,"b"]}`, false},
+		{JSONBProperty, []interface{}{"x", nil}, `["x",null]`, false},
+		{JSONBAllProperties, "hello", `{"data":"hello","name":"n"}`, false},
+		{JSONBUnmappedProperties, "hello", `{"other":true}`, false},
+	}
+	for _, test := range tests {
+		table.JSONBMode = test.mode
+		feature := geojson.NewPointFeature([]float64{1, 2})
+		feature.Properties = map[string]interface{}{"name": "n", "data": test.value}
+		if test.mode == JSONBUnmappedProperties {
+			feature.Properties["other"] = true
+		}
+		jsonb, err := table.JSONBValue(Column{Name: "data", Type: JSONB}, feature)
+		if err != nil {
+			t.Errorf("JSONBValue(%#v) error: %v", test.value, err)
+			continue
+		}
+		if test.null {
+			if jsonb.Status != pgtype.Null {
+				t.Errorf("JSONBValue(%#v) = %+v, want NULL", test.value, jsonb)
+			}
+			continue
+		}
+		if jsonb.Status != pgtype.Present || !json.Valid(jsonb.Bytes) || string(jsonb.Bytes) != test.want {
+			t.Errorf("JSONBValue(%#v) = %s, want %s", test.value, jsonb.Bytes, test.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package pgpush
+
+import (
+	"github.com/paulmach/go.geojson"
+	"time"
+)
+
+// a structured logger, *slog.Logger satisfies this interface
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// a logger that discards everything
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+// the logger used by tables without their own and by the exporters
+// nothing is logged by default
+var DefaultLogger Logger = nopLogger{}
+
+// callbacks for collecting metrics from a table
+// any hook left nil is skipped
+type Hooks struct {
+	// called after a batch is inserted with the number of rows written
+	RowsAdded func(tablename string, rows int)
+
+	// called after every batch insert whether it succeeded or not
+	BatchFlushed func(tablename string, rows int, latency time.Duration, err error)
+
+	// called for every feature AddFeature refuses
+	FeatureRejected func(tablename string, feature *geojson.Feature, err error)
+
+	// called after every commit with the table's checkpoint
+	Committed func(checkpoint Checkpoint)
+}
+
+// returns the table's logger falling back to the DefaultLogger
+func (table *Table) logger() Logger {
+	if table.Logger == nil {
+		return DefaultLogger
+	}
+	return table.Logger
+}
+
+// logs and reports a rejected feature returning the error
+// wrapped as a RejectError
+func (table *Table) reject(feature *geojson.Feature, err error) error {
+	err = &RejectError{Err: err}
+	table.logger().Warn("feature rejected", "table", table.TableName, "error", err)
+	table.deadLetter(feature, err)
+	if table.Hooks.FeatureRejected != nil {
+		table.Hooks.FeatureRejected(table.TableName, feature, err)
+	}
+	return err
+}
+
+// logs and reports a batch insert
+func (table *Table) flushed(rows int, latency time.Duration, err error) {
+	if err != nil {
+		table.logger().Error("batch insert failed", "table", table.TableName, "rows", rows, "duration", latency, "error", err)
+	} else {
+		table.logger().Debug("batch inserted", "table", table.TableName, "rows", rows, "duration", latency)
+		if table.Hooks.RowsAdded != nil {
+			table.Hooks.RowsAdded(table.TableName, rows)
+		}
+	}
+	if table.Hooks.BatchFlushed != nil {
+		table.Hooks.BatchFlushed(table.TableName, rows, latency, err)
+	}
+}
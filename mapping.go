@@ -0,0 +1,154 @@
+package pgpush
+
+import (
+	"fmt"
+	"github.com/paulmach/go.geojson"
+	"strings"
+)
+
+// the longest identifier postgres keeps
+const maxIdentifierLength = 63
+
+// a transform applied to a property value before it's inserted
+type Transform func(value interface{}) (interface{}, error)
+
+// computes a column's value from a feature's (already mapped) properties
+type ComputedColumn func(properties map[string]interface{}) (interface{}, error)
+
+// how a table maps feature properties onto its columns
+// nested objects are flattened first, properties are then renamed,
+// sanitized and transformed and the computed columns are added last
+type PropertyMapping struct {
+	Flatten    *Flatten                  // expands nested objects when set
+	Rename     map[string]string         // source property names to column names
+	Sanitize   bool                      // turns other property names into valid column names
+	Transforms map[string][]Transform    // transforms for each column applied in order
+	Computed   map[string]ComputedColumn // columns computed from the properties
+}
+
+// lowercases string values
+var Lowercase Transform = func(value interface{}) (interface{}, error) {
+	val, boolval := value.(string)
+	if !boolval {
+		return value, nil
+	}
+	return strings.ToLower(val), nil
+}
+
+// trims the whitespace around string values
+var Trim Transform = func(value interface{}) (interface{}, error) {
+	val, boolval := value.(string)
+	if !boolval {
+		return value, nil
+	}
+	return strings.TrimSpace(val), nil
+}
+
+// replaces a missing or nil value with the given default
+func Default(defaultval interface{}) Transform {
+	return func(value interface{}) (interface{}, error) {
+		if value == nil {
+			return defaultval, nil
+		}
+		return value, nil
+	}
+}
+
+// turns a property name into a valid unquoted column name
+// i.e. "Name:en" gives "name_en" and "ROAD_CLASS" gives "road_class"
+func SanitizeName(name string) string {
+	var builder strings.Builder
+	underscore := false
+	for _, char := range strings.ToLower(name) {
+		if (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') {
+			builder.WriteRune(char)
+			underscore = false
+		} else if !underscore && builder.Len() > 0 {
+			builder.WriteByte('_')
+			underscore = true
+		}
+	}
+	val := strings.TrimSuffix(builder.String(), "_")
+	if val == "" || (val[0] >= '0' && val[0] <= '9') {
+		val = "_" + val
+	}
+	if len(val) > maxIdentifierLength {
+		val = val[:maxIdentifierLength]
+	}
+	return val
+}
+
+// returns the column name for a property and whether it was renamed
+func (mapping *PropertyMapping) columnName(name string) (string, bool) {
+	column, boolval := mapping.Rename[name]
+	if boolval {
+		return column, true
+	}
+	if mapping.Sanitize {
+		return SanitizeName(name), false
+	}
+	return name, false
+}
+
+// returns a copy of the feature with its properties mapped
+// when two properties end up with the same column a renamed one wins
+// over one already named like the column which wins over a sanitized one
+func (mapping *PropertyMapping) apply(feature *geojson.Feature) (*geojson.Feature, error) {
+	sourceproperties := feature.Properties
+	if mapping.Flatten != nil {
+		sourceproperties = FlattenProperties(sourceproperties, *mapping.Flatten)
+	}
+
+	properties := make(map[string]interface{}, len(sourceproperties)+len(mapping.Computed))
+	rank := make(map[string]int, len(sourceproperties))
+	source := make(map[string]string, len(sourceproperties))
+	for k, v := range sourceproperties {
+		column, renamed := mapping.columnName(k)
+		myrank := 0
+		if renamed {
+			myrank = 2
+		} else if column == k {
+			myrank = 1
+		}
+		// ties go to the first source name so the result doesn't
+		// depend on map order
+		current, exists := rank[column]
+		if exists && (current > myrank || (current == myrank && source[column] < k)) {
+			continue
+		}
+		rank[column] = myrank
+		source[column] = k
+		properties[column] = v
+	}
+
+	for column, transforms := range mapping.Transforms {
+		value := properties[column]
+		for _, transform := range transforms {
+			val, err := transform(value)
+			if err != nil {
+				return nil, fmt.Errorf("transform for %s: %w", column, err)
+			}
+			value = val
+		}
+		if value != nil {
+			properties[column] = value
+		}
+	}
+
+	// computing from the mapped properties before any are added
+	computed := make(map[string]interface{}, len(mapping.Computed))
+	for column, compute := range mapping.Computed {
+		value, err := compute(properties)
+		if err != nil {
+			return nil, fmt.Errorf("computed column %s: %w", column, err)
+		}
+		computed[column] = value
+	}
+	for column, value := range computed {
+		properties[column] = value
+	}
+
+	mapped := *feature
+	mapped.Properties = properties
+	return &mapped, nil
+}
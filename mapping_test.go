@@ -0,0 +1,124 @@
+package pgpush
+
+import (
+	"errors"
+	"github.com/paulmach/go.geojson"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"name", "name"},
+		{"Name:en", "name_en"},
+		{"ROAD_CLASS", "road_class"},
+		{"  max speed (km/h) ", "max_speed_km_h"},
+		{"a--b", "a_b"},
+		{"2lanes", "_2lanes"},
+		{"", "_"},
+		{"!!!", "_"},
+		{"straße", "stra_e"},
+		{strings.Repeat("a", 70), strings.Repeat("a", maxIdentifierLength)},
+	}
+	for _, test := range tests {
+		if got := SanitizeName(test.name); got != test.want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMappingPrecedence(t *testing.T) {
+	mapping := &PropertyMapping{
+		Rename:   map[string]string{"NAME": "name", "label": "title"},
+		Sanitize: true,
+	}
+	tests := []struct {
+		properties map[string]interface{}
+		want       map[string]interface{}
+	}{
+		// a renamed property wins over one already named like the column
+		{map[string]interface{}{"NAME": "renamed", "name": "plain"}, map[string]interface{}{"name": "renamed"}},
+		// one already named like the column wins over a sanitized one
+		{map[string]interface{}{"title": "plain", "Title": "sanitized"}, map[string]interface{}{"title": "plain"}},
+		// between two sanitized ones the smaller source name wins
+		{map[string]interface{}{"Road-Class": "a", "Road Class": "b"}, map[string]interface{}{"road_class": "b"}},
+		// a rename wins over a sanitized property
+		{map[string]interface{}{"label": "renamed", "Title": "sanitized"}, map[string]interface{}{"title": "renamed"}},
+	}
+	for _, test := range tests {
+		// repeated so map order can't make a case pass by chance
+		for i := 0; i < 20; i++ {
+			mapped, err := mapping.apply(&geojson.Feature{Properties: test.properties})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(mapped.Properties, test.want) {
+				t.Errorf("apply(%v) = %v, want %v", test.properties, mapped.Properties, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMappingOrder(t *testing.T) {
+	mapping := &PropertyMapping{
+		Flatten:  &Flatten{Separator: "_"},
+		Rename:   map[string]string{"address_city": "city"},
+		Sanitize: true,
+		Transforms: map[string][]Transform{
+			// transforms run on the renamed and sanitized names in order
+			"city":   {Trim, Lowercase},
+			"status": {Default("open")},
+			"kind":   {Lowercase, Default("other")},
+		},
+		Computed: map[string]ComputedColumn{
+			// computed columns only see the mapped properties
+			"label": func(properties map[string]interface{}) (interface{}, error) {
+				if _, boolval := properties["other"]; boolval {
+					return nil, errors.New("saw the other computed column")
+				}
+				return properties["city"].(string) + "/" + properties["status"].(string), nil
+			},
+			"other": func(properties map[string]interface{}) (interface{}, error) {
+				_, boolval := properties["label"]
+				return boolval, nil
+			},
+		},
+	}
+	feature := &geojson.Feature{Properties: map[string]interface{}{
+		"address": map[string]interface{}{"city": "  Berlin "},
+		"Kind":    nil,
+	}}
+	mapped, err := mapping.apply(feature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"city":   "berlin",
+		"status": "open",
+		"kind":   "other",
+		"label":  "berlin/open",
+		"other":  false,
+	}
+	if !reflect.DeepEqual(mapped.Properties, want) {
+		t.Errorf("apply = %v, want %v", mapped.Properties, want)
+	}
+	if _, boolval := feature.Properties["city"]; boolval {
+		t.Errorf("apply modified the source feature")
+	}
+}
+
+func TestMappingTransformError(t *testing.T) {
+	failing := func(value interface{}) (interface{}, error) {
+		return nil, errors.New("bad value")
+	}
+	mapping := &PropertyMapping{Transforms: map[string][]Transform{"name": {failing}}}
+	_, err := mapping.apply(&geojson.Feature{Properties: map[string]interface{}{"name": "a"}})
+	if err == nil || !strings.Contains(err.Error(), "name") {
+		t.Errorf("apply error = %v, want the transform error for name", err)
+	}
+}
@@ -0,0 +1,450 @@
+package pgpush
+
+import (
+	"context"
+	"github.com/jackc/pgx"
+	"github.com/paulmach/go.geojson"
+	"github.com/qedus/osmpbf"
+	"io"
+	"os"
+	"runtime"
+)
+
+// tag keys that make a closed way a polygon instead of a line
+var OSMAreaKeys = []string{
+	"area",
+	"building",
+	"landuse",
+	"leisure",
+	"natural",
+	"amenity",
+	"water",
+	"waterway",
+	"place",
+	"boundary",
+}
+
+// the table suffixes for each geometry type
+var OSMPointSuffix = "_point"
+var OSMLineSuffix = "_line"
+var OSMPolygonSuffix = "_polygon"
+
+// osm import configuration
+type OSMConfig struct {
+	TablePrefix  string   // prefix for the point, line and polygon tables, may be schema qualified
+	Columns      []Column // tags mapped to their own columns
+	HStoreColumn string   // hstore column for the rest of the tags
+	TargetSRID   int
+	Logger       Logger     // logger given to each table
+	Hooks        Hooks      // metrics hooks given to each table
+	DeadLetter   DeadLetter // rejected features are skipped when set
+	CreateMode   CreateMode // how existing tables are handled
+
+	// commits every table after this many osm elements, with Checkpoint
+	// every commit is recorded in the CheckpointTable and a restarted
+	// import of the same file resumes after the last one
+	CommitEvery int64
+	Checkpoint  bool
+}
+
+// the tables written to by an osm import
+type osmTables struct {
+	Point   *Table
+	Line    *Table
+	Polygon *Table
+}
+
+func (tables osmTables) all() []*Table {
+	return []*Table{tables.Point, tables.Line, tables.Polygon}
+}
+
+// creates the columns for each osm table
+func (osmconfig *OSMConfig) columns() []Column {
+	columns := []Column{{Name: "osm_id", Type: BigInt}}
+	for _, column := range osmconfig.Columns {
+		column.KeepColumn = true
+		columns = append(columns, column)
+	}
+	return append(columns,
+		Column{Name: osmconfig.HStoreColumn, Type: HStore},
+		Column{Name: "geometry", Type: Geometry, TargetSRID: osmconfig.TargetSRID},
+	)
+}
+
+// creates the properties map for a given osm element
+// selected tags map to their columns and the hstore column
+// picks up the rest
+func osmProperties(id int64, tags map[string]string) map[string]interface{} {
+	properties := make(map[string]interface{}, len(tags)+1)
+	for k, v := range tags {
+		properties[k] = v
+	}
+	properties["osm_id"] = id
+	return properties
+}
+
+// returns whether a closed way with the given tags is an area
+func IsOSMArea(tags map[string]string) bool {
+	if tags["area"] == "no" {
+		return false
+	}
+	for _, key := range OSMAreaKeys {
+		_, boolval := tags[key]
+		if boolval {
+			return true
+		}
+	}
+	return false
+}
+
+// creates a decoder for the given pbf file
+func newOSMDecoder(file *os.File) (*osmpbf.Decoder, error) {
+	_, err := file.Seek(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	decoder := osmpbf.NewDecoder(file)
+	decoder.SetBufferSize(osmpbf.MaxBlobSize)
+	err = decoder.Start(runtime.GOMAXPROCS(-1))
+	return decoder, err
+}
+
+// collects the way ids used as members of multipolygon relations
+// and the ids of the nodes used by ways, only those nodes are cached
+func osmReferences(ctx context.Context, file *os.File) (map[int64][][]float64, map[int64]struct{}, error) {
+	decoder, err := newOSMDecoder(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ways := map[int64][][]float64{}
+	nodeids := map[int64]struct{}{}
+	for {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		v, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		switch v := v.(type) {
+		case *osmpbf.Way:
+			for _, id := range v.NodeIDs {
+				nodeids[id] = struct{}{}
+			}
+		case *osmpbf.Relation:
+			if v.Tags["type"] != "multipolygon" {
+				continue
+			}
+			for _, member := range v.Members {
+				if member.Type == osmpbf.WayType {
+					ways[member.ID] = nil
+				}
+			}
+		}
+	}
+	return ways, nodeids, nil
+}
+
+// reads an osm pbf file and inserts its nodes, ways and multipolygon
+// relations into point, line and polygon tables
+func ImportOSM(filename string, osmconfig OSMConfig, config pgx.ConnPoolConfig) error {
+	return ImportOSMContext(context.Background(), filename, osmconfig, config)
+}
+
+// imports an osm pbf file stopping and rolling back the open
+// transactions when the context is cancelled
+func ImportOSMContext(ctx context.Context, filename string, osmconfig OSMConfig, config pgx.ConnPoolConfig) error {
+	if osmconfig.HStoreColumn == "" {
+		osmconfig.HStoreColumn = "tags"
+	}
+	if osmconfig.TargetSRID == 0 {
+		osmconfig.TargetSRID = DefaultSRID
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// first pass collects the ways needed to assemble relations and
+	// the nodes needed to build ways, the coordinates of every node a
+	// way uses are still held in memory for the rest of the import
+	relationways, nodeids, err := osmReferences(ctx, file)
+	if err != nil {
+		return err
+	}
+
+	// opening the checkpoint to resume from if there is one, the
+	// checkpoints are kept in the database with the rows they cover
+	checkpointer := &Checkpointer{Checkpoint: ImportCheckpoint{Tables: map[string]Checkpoint{}}}
+	if osmconfig.Checkpoint {
+		input, err := InputID(filename)
+		if err != nil {
+			return err
+		}
+		p, err := pgx.NewConnPool(config)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		checkpointer, err = OpenCheckpointerDB(ctx, p, "", input)
+		if err != nil {
+			return err
+		}
+	}
+
+	// creating the tables or opening them when resuming
+	columns := osmconfig.columns()
+	tables := osmTables{}
+	open := func(tablename string) (*Table, error) {
+		if checkpointer.Resuming(tablename) {
+			table, err := OpenTableContext(ctx, tablename, columns, config)
+			if err != nil {
+				return nil, err
+			}
+			checkpointer.Resume(table)
+			checkpointer.Track(table)
+			return table, nil
+		}
+		table, err := CreateTableContext(ctx, tablename, columns, config, osmconfig.CreateMode)
+		if err != nil {
+			return nil, err
+		}
+		// recording the new table so a restart opens it instead
+		return table, checkpointer.Commit(ctx, table, 0)
+	}
+	// rolling back anything uncommitted when the import fails and
+	// closing every table
+	defer func() {
+		for _, table := range tables.all() {
+			if table != nil {
+				table.Rollback()
+				table.Close()
+			}
+		}
+	}()
+	tables.Point, err = open(osmconfig.TablePrefix + OSMPointSuffix)
+	if err != nil {
+		return err
+	}
+	tables.Line, err = open(osmconfig.TablePrefix + OSMLineSuffix)
+	if err != nil {
+		return err
+	}
+	tables.Polygon, err = open(osmconfig.TablePrefix + OSMPolygonSuffix)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables.all() {
+		table.DynamicHStore = true
+		table.Logger = osmconfig.Logger
+		table.Hooks = osmconfig.Hooks
+		table.DeadLetter = osmconfig.DeadLetter
+	}
+
+	// commits every table recording the elements read so far
+	// a failed batch was dead lettered and the commit still went through
+	commit := func(offset int64) error {
+		for _, table := range tables.all() {
+			err := checkpointer.Commit(ctx, table, offset)
+			_, partial := err.(*BatchError)
+			if err != nil && !(partial && osmconfig.DeadLetter != nil) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	decoder, err := newOSMDecoder(file)
+	if err != nil {
+		return err
+	}
+
+	nodes := map[int64][]float64{}
+	var index, committed int64
+	for ; ; index++ {
+		v, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		// each element gives at most one feature for one table
+		var feature *geojson.Feature
+		var table *Table
+		switch v := v.(type) {
+		case *osmpbf.Node:
+			_, boolval := nodeids[v.ID]
+			if boolval {
+				nodes[v.ID] = []float64{v.Lon, v.Lat}
+				delete(nodeids, v.ID)
+			}
+			if len(v.Tags) > 0 {
+				feature = geojson.NewPointFeature([]float64{v.Lon, v.Lat})
+				feature.Properties = osmProperties(v.ID, v.Tags)
+				table = tables.Point
+			}
+		case *osmpbf.Way:
+			line := [][]float64{}
+			for _, id := range v.NodeIDs {
+				pt, boolval := nodes[id]
+				if boolval {
+					line = append(line, pt)
+				}
+			}
+			_, boolval := relationways[v.ID]
+			if boolval {
+				relationways[v.ID] = line
+			}
+			if len(v.Tags) == 0 || len(line) < 2 {
+				break
+			}
+
+			closed := len(line) > 3 && line[0][0] == line[len(line)-1][0] && line[0][1] == line[len(line)-1][1]
+			if closed && IsOSMArea(v.Tags) {
+				feature = geojson.NewPolygonFeature([][][]float64{line})
+				table = tables.Polygon
+			} else {
+				feature = geojson.NewLineStringFeature(line)
+				table = tables.Line
+			}
+			feature.Properties = osmProperties(v.ID, v.Tags)
+		case *osmpbf.Relation:
+			if v.Tags["type"] != "multipolygon" {
+				break
+			}
+			multipolygon := AssembleMultiPolygon(v, relationways)
+			if len(multipolygon) == 0 {
+				break
+			}
+			tags := map[string]string{}
+			for k, val := range v.Tags {
+				if k != "type" {
+					tags[k] = val
+				}
+			}
+			feature = geojson.NewMultiPolygonFeature(multipolygon...)
+			// relation ids are negated to keep them apart from way ids
+			feature.Properties = osmProperties(-v.ID, tags)
+			table = tables.Polygon
+		}
+
+		if feature != nil && !checkpointer.Skip(table.TableName, index) {
+			// a commit while adding the feature covers its element
+			checkpointer.Advance(index + 1)
+			err = table.AddFeatureContext(ctx, feature)
+			// rejected features and failed batches were sent to the
+			// dead letter so they only stop the import without one
+			_, rejected := err.(*RejectError)
+			_, partial := err.(*BatchError)
+			if err != nil && !((rejected || partial) && osmconfig.DeadLetter != nil) {
+				return err
+			}
+		}
+
+		if osmconfig.CommitEvery > 0 && index+1-committed >= osmconfig.CommitEvery {
+			err = commit(index + 1)
+			if err != nil {
+				return err
+			}
+			committed = index + 1
+		}
+	}
+
+	// commiting each table
+	return commit(index)
+}
+
+// assembles the member ways of a multipolygon relation into polygons
+func AssembleMultiPolygon(relation *osmpbf.Relation, ways map[int64][][]float64) [][][][]float64 {
+	outerlines, innerlines := [][][]float64{}, [][][]float64{}
+	for _, member := range relation.Members {
+		line, boolval := ways[member.ID]
+		if member.Type != osmpbf.WayType || !boolval || len(line) < 2 {
+			continue
+		}
+		if member.Role == "inner" {
+			innerlines = append(innerlines, line)
+		} else {
+			outerlines = append(outerlines, line)
+		}
+	}
+	outers, inners := BuildRings(outerlines), BuildRings(innerlines)
+
+	// assigning each inner ring to the first outer ring containing it
+	polygons := make([][][][]float64, len(outers))
+	for pos, outer := range outers {
+		polygons[pos] = [][][]float64{outer}
+	}
+	for _, inner := range inners {
+		for pos, outer := range outers {
+			if RingContains(outer, inner[0]) {
+				polygons[pos] = append(polygons[pos], inner)
+				break
+			}
+		}
+	}
+	return polygons
+}
+
+// joins line segments end to end into closed rings
+// segments that can't be closed and empty ones are dropped
+func BuildRings(lines [][][]float64) [][][]float64 {
+	rings := [][][]float64{}
+	used := make([]bool, len(lines))
+	equal := func(a, b []float64) bool {
+		return a[0] == b[0] && a[1] == b[1]
+	}
+	for pos := range lines {
+		if used[pos] || len(lines[pos]) == 0 {
+			continue
+		}
+		used[pos] = true
+		ring := append([][]float64{}, lines[pos]...)
+		for !equal(ring[0], ring[len(ring)-1]) {
+			found := false
+			for pos2, line := range lines {
+				if used[pos2] || len(line) == 0 {
+					continue
+				}
+				last := ring[len(ring)-1]
+				if equal(last, line[0]) {
+					ring = append(ring, line[1:]...)
+				} else if equal(last, line[len(line)-1]) {
+					for i := len(line) - 2; i >= 0; i-- {
+						ring = append(ring, line[i])
+					}
+				} else {
+					continue
+				}
+				used[pos2] = true
+				found = true
+				break
+			}
+			if !found {
+				break
+			}
+		}
+		if len(ring) > 3 && equal(ring[0], ring[len(ring)-1]) {
+			rings = append(rings, ring)
+		}
+	}
+	return rings
+}
+
+// returns whether a point lies within a ring using ray casting
+func RingContains(ring [][]float64, pt []float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > pt[1]) != (b[1] > pt[1]) && pt[0] < (b[0]-a[0])*(pt[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
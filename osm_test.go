@@ -0,0 +1,110 @@
+package pgpush
+
+import (
+	"github.com/qedus/osmpbf"
+	"reflect"
+	"testing"
+)
+
+func TestBuildRings(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines [][][]float64
+		want  [][][]float64
+	}{
+		{
+			"closed way",
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}},
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}},
+		},
+		{
+			"two halves",
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}}, {{1, 1}, {0, 1}, {0, 0}}},
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}},
+		},
+		{
+			"reversed segment",
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}}, {{0, 0}, {0, 1}, {1, 1}}},
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}},
+		},
+		{
+			"segments out of order",
+			[][][]float64{{{0, 0}, {1, 0}}, {{0, 1}, {0, 0}}, {{1, 0}, {1, 1}}, {{1, 1}, {0, 1}}},
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}},
+		},
+		{
+			"two separate rings",
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}, {{5, 5}, {6, 5}, {6, 6}, {5, 5}}},
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}, {{5, 5}, {6, 5}, {6, 6}, {5, 5}}},
+		},
+		{
+			"empty lines",
+			[][][]float64{{}, {{0, 0}, {1, 0}, {1, 1}}, {}, {{1, 1}, {0, 0}}},
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}},
+		},
+		{
+			"unclosable segment dropped",
+			[][][]float64{{{0, 0}, {1, 0}, {1, 1}}, {{5, 5}, {6, 5}, {6, 6}, {5, 5}}},
+			[][][]float64{{{5, 5}, {6, 5}, {6, 6}, {5, 5}}},
+		},
+		{
+			"degenerate ring dropped",
+			[][][]float64{{{0, 0}, {1, 0}, {0, 0}}},
+			[][][]float64{},
+		},
+		{
+			"no lines",
+			[][][]float64{},
+			[][][]float64{},
+		},
+	}
+	for _, test := range tests {
+		got := BuildRings(test.lines)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: BuildRings = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRingContains(t *testing.T) {
+	ring := [][]float64{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}}
+	tests := []struct {
+		pt   []float64
+		want bool
+	}{
+		{[]float64{2, 2}, true},
+		{[]float64{0.5, 3.5}, true},
+		{[]float64{5, 2}, false},
+		{[]float64{-1, -1}, false},
+	}
+	for _, test := range tests {
+		if got := RingContains(ring, test.pt); got != test.want {
+			t.Errorf("RingContains(%v) = %v, want %v", test.pt, got, test.want)
+		}
+	}
+}
+
+func TestAssembleMultiPolygon(t *testing.T) {
+	ways := map[int64][][]float64{
+		1: {{0, 0}, {4, 0}, {4, 4}},
+		2: {{4, 4}, {0, 4}, {0, 0}},
+		3: {{1, 1}, {2, 1}, {2, 2}, {1, 1}},
+		4: {{10, 10}, {11, 10}, {11, 11}, {10, 10}},
+	}
+	relation := &osmpbf.Relation{Members: []osmpbf.Member{
+		{ID: 1, Type: osmpbf.WayType, Role: "outer"},
+		{ID: 3, Type: osmpbf.WayType, Role: "inner"},
+		{ID: 2, Type: osmpbf.WayType, Role: "outer"},
+		{ID: 4, Type: osmpbf.WayType, Role: ""},
+		{ID: 5, Type: osmpbf.WayType, Role: "outer"},
+		{ID: 1, Type: osmpbf.NodeType, Role: "outer"},
+	}}
+	want := [][][][]float64{
+		{{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}},
+		{{{10, 10}, {11, 10}, {11, 11}, {10, 10}}},
+	}
+	got := AssembleMultiPolygon(relation, ways)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AssembleMultiPolygon = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,391 @@
+package pgpush
+
+import (
+	"context"
+	"fmt"
+	"github.com/paulmach/go.geojson"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a struct field mapped to a column
+type structField struct {
+	Index  []int
+	Column Column
+}
+
+var geometryType = reflect.TypeOf(geojson.Geometry{})
+var timeType = reflect.TypeOf(time.Time{})
+
+// the mapped fields of each struct type already seen
+var structFieldCache sync.Map
+
+// the cached result of mapping a struct type
+type cachedFields struct {
+	fields []structField
+	err    error
+}
+
+// infers the column type for a struct field's go type
+// pointers are mapped like the type they point to
+func goColumnType(typ reflect.Type) (ColumnType, bool) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ {
+	case geometryType:
+		return Geometry, true
+	case timeType:
+		return TimestampWithTimezone, true
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return Text, true
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return BigInt, true
+	case reflect.Uint, reflect.Uint64:
+		// numeric as a bigint can't hold the top half of a uint64
+		return Numeric, true
+	case reflect.Int32, reflect.Uint16:
+		return Integer, true
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return SmallInt, true
+	case reflect.Float64:
+		return Double, true
+	case reflect.Float32:
+		return Real, true
+	case reflect.Bool:
+		return Boolean, true
+	case reflect.Map:
+		if typ.Key().Kind() != reflect.String {
+			return "", false
+		}
+		if typ.Elem().Kind() == reflect.String {
+			return HStore, true
+		}
+		return JSONB, true
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return Bytea, true
+		}
+		elem, boolval := goColumnType(typ.Elem())
+		if !boolval || elem.Category() == "array" || elem == Geometry {
+			return "", false
+		}
+		return ArrayOf(elem), true
+	}
+	return "", false
+}
+
+// splits a struct tag on commas outside of parentheses
+// so types like numeric(10,2) stay together
+func splitTag(tag string) []string {
+	parts := []string{}
+	depth, start := 0, 0
+	for pos, char := range tag {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, tag[start:pos])
+				start = pos + 1
+			}
+		}
+	}
+	return append(parts, tag[start:])
+}
+
+// returns the fields of a struct type mapped to columns
+// a field is tagged `pgpush:"name,type=integer,pk"`, the name defaults to
+// the lowercased field name, the type is inferred from the go type
+// if not given and a "-" name skips the field
+// embedded structs without a tag have their fields mapped as well
+// the mapping is cached per type and the returned fields are shared
+// so they mustn't be modified
+func structFields(typ reflect.Type) ([]structField, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if cached, boolval := structFieldCache.Load(typ); boolval {
+		return cached.(cachedFields).fields, cached.(cachedFields).err
+	}
+	fields, err := mapStructFields(typ)
+	structFieldCache.Store(typ, cachedFields{fields: fields, err: err})
+	return fields, err
+}
+
+// maps the fields of a struct type to columns, see structFields
+func mapStructFields(typ reflect.Type) ([]structField, error) {
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot map %s to columns", typ)
+	}
+
+	fields := []structField{}
+	for pos := 0; pos < typ.NumField(); pos++ {
+		field := typ.Field(pos)
+		tag, tagged := field.Tag.Lookup("pgpush")
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && !tagged {
+			embedded, err := structFields(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range embedded {
+				i.Index = append([]int{pos}, i.Index...)
+				fields = append(fields, i)
+			}
+			continue
+		}
+
+		column := Column{Name: strings.ToLower(field.Name)}
+		for partpos, part := range splitTag(tag) {
+			part = strings.TrimSpace(part)
+			if partpos == 0 {
+				if part != "" {
+					column.Name = part
+				}
+			} else if strings.HasPrefix(part, "type=") {
+				column.Type = ColumnType(strings.TrimPrefix(part, "type="))
+			} else if part == "pk" {
+				column.PrimaryKey = true
+			} else if part != "" {
+				return nil, fmt.Errorf("unknown pgpush tag option %q on %s.%s", part, typ.Name(), field.Name)
+			}
+		}
+		if column.Type == "" {
+			columntype, boolval := goColumnType(field.Type)
+			if !boolval {
+				return nil, fmt.Errorf("cannot infer a column type for %s.%s of type %s", typ.Name(), field.Name, field.Type)
+			}
+			column.Type = columntype
+		}
+		// struct fields always get their own column
+		column.KeepColumn = true
+		fields = append(fields, structField{Index: []int{pos}, Column: column})
+	}
+	return fields, nil
+}
+
+// derives the columns of a table from the fields of a struct
+// value can be a struct, a pointer to one or a slice of them
+func StructColumns(value interface{}) ([]Column, error) {
+	typ := reflect.TypeOf(value)
+	for typ != nil && (typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice) {
+		typ = typ.Elem()
+	}
+	if typ == nil {
+		return nil, fmt.Errorf("cannot map %T to columns", value)
+	}
+	fields, err := structFields(typ)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]Column, len(fields))
+	for pos, field := range fields {
+		columns[pos] = field.Column
+	}
+	return columns, nil
+}
+
+// returns the field of a struct value for the given index
+// nil if an embedded pointer on the way is nil
+func fieldValue(vv reflect.Value, index []int) (reflect.Value, bool) {
+	for _, pos := range index {
+		for vv.Kind() == reflect.Ptr {
+			if vv.IsNil() {
+				return reflect.Value{}, false
+			}
+			vv = vv.Elem()
+		}
+		vv = vv.Field(pos)
+	}
+	return vv, true
+}
+
+// converts a struct into a feature with a property for each column
+// and the geometry field as the geometry, nil pointers become nil
+func StructFeature(value interface{}) (*geojson.Feature, error) {
+	fields, err := structFields(reflect.TypeOf(value))
+	if err != nil {
+		return nil, err
+	}
+	vv := reflect.ValueOf(value)
+	for vv.Kind() == reflect.Ptr {
+		if vv.IsNil() {
+			return nil, fmt.Errorf("cannot convert a nil %T to a feature", value)
+		}
+		vv = vv.Elem()
+	}
+
+	feature := &geojson.Feature{Properties: make(map[string]interface{}, len(fields))}
+	for _, field := range fields {
+		fieldval, boolval := fieldValue(vv, field.Index)
+		for boolval && fieldval.Kind() == reflect.Ptr {
+			boolval = !fieldval.IsNil()
+			if boolval {
+				fieldval = fieldval.Elem()
+			}
+		}
+		if field.Column.Type == Geometry {
+			if boolval {
+				geometry := fieldval.Interface().(geojson.Geometry)
+				feature.Geometry = &geometry
+			}
+			continue
+		}
+		if boolval {
+			feature.Properties[field.Column.Name] = fieldval.Interface()
+		} else {
+			feature.Properties[field.Column.Name] = nil
+		}
+	}
+	if feature.Geometry == nil {
+		return nil, fmt.Errorf("%T has no geometry", value)
+	}
+	return feature, nil
+}
+
+// adds a struct to the table as a feature
+func (table *Table) AddStruct(value interface{}) error {
+	return table.AddStructContext(context.Background(), value)
+}
+
+// adds a struct to the table using the given context
+func (table *Table) AddStructContext(ctx context.Context, value interface{}) error {
+	feature, err := StructFeature(value)
+	if err != nil {
+		return table.reject(&geojson.Feature{}, err)
+	}
+	return table.AddFeatureContext(ctx, feature)
+}
+
+// adds every struct in a slice or received from a channel until it's closed
+// stopping at the first error
+func (table *Table) AddStructs(values interface{}) error {
+	return table.AddStructsContext(context.Background(), values)
+}
+
+// adds a slice or channel of structs using the given context
+func (table *Table) AddStructsContext(ctx context.Context, values interface{}) error {
+	vv := reflect.ValueOf(values)
+	switch vv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for pos := 0; pos < vv.Len(); pos++ {
+			err := table.AddStructContext(ctx, vv.Index(pos).Interface())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Chan:
+		for {
+			value, boolval := vv.Recv()
+			if !boolval {
+				return nil
+			}
+			err := table.AddStructContext(ctx, value.Interface())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("cannot add %T as structs", values)
+}
+
+// reads every row of a table into a pointer to a slice of structs
+// only the struct's columns are selected, the geometry is read as geojson
+func ReadStructs(tablename string, db DB, dest interface{}) error {
+	return ReadStructsContext(context.Background(), tablename, db, dest)
+}
+
+// reads every row of a table into structs using the given context
+func ReadStructsContext(ctx context.Context, tablename string, db DB, dest interface{}) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("cannot read structs into %T", dest)
+	}
+	slice = slice.Elem()
+	elemtype := slice.Type().Elem()
+	structtype := elemtype
+	if structtype.Kind() == reflect.Ptr {
+		structtype = structtype.Elem()
+	}
+	fields, err := structFields(structtype)
+	if err != nil {
+		return err
+	}
+
+	selectlist := make([]string, len(fields))
+	for pos, field := range fields {
+		if field.Column.Type == Geometry {
+			selectlist[pos] = fmt.Sprintf("ST_AsGeoJSON(%s)", QuoteIdentifier(field.Column.Name))
+		} else {
+			selectlist[pos] = QuoteIdentifier(field.Column.Name)
+		}
+	}
+	querystring := fmt.Sprintf("select %s from %s", strings.Join(selectlist, ","), QuoteTableName(tablename))
+	rows, err := db.QueryEx(ctx, querystring, nil)
+	if err != nil {
+		return newTableError(tablename, OpQuery, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		elem := reflect.New(structtype)
+		targets := make([]interface{}, len(fields))
+		geometries := make([]*string, len(fields))
+		for pos, field := range fields {
+			if field.Column.Type == Geometry {
+				targets[pos] = &geometries[pos]
+				continue
+			}
+			fieldval, boolval := fieldValue(elem, field.Index)
+			if !boolval {
+				return fmt.Errorf("cannot read into the nil embedded struct of %s", structtype)
+			}
+			targets[pos] = fieldval.Addr().Interface()
+		}
+
+		err = rows.Scan(targets...)
+		if err != nil {
+			return newTableError(tablename, OpQuery, err)
+		}
+
+		// decoding the geometries into their fields
+		for pos, geometrystring := range geometries {
+			if fields[pos].Column.Type != Geometry || geometrystring == nil {
+				continue
+			}
+			geometry, err := geojson.UnmarshalGeometry([]byte(*geometrystring))
+			if err != nil {
+				return err
+			}
+			fieldval, _ := fieldValue(elem, fields[pos].Index)
+			if fieldval.Kind() == reflect.Ptr {
+				fieldval.Set(reflect.ValueOf(geometry))
+			} else {
+				fieldval.Set(reflect.ValueOf(*geometry))
+			}
+		}
+
+		if elemtype.Kind() == reflect.Ptr {
+			slice.Set(reflect.Append(slice, elem))
+		} else {
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+	}
+	if rows.Err() != nil {
+		return newTableError(tablename, OpQuery, rows.Err())
+	}
+	return nil
+}
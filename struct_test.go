@@ -0,0 +1,112 @@
+package pgpush
+
+import (
+	"bytes"
+	"context"
+	"github.com/jackc/pgx"
+	"github.com/paulmach/go.geojson"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type blobRow struct {
+	ID       int64             `pgpush:"id,pk"`
+	Data     []byte            `pgpush:"data"`
+	Size     uint64            `pgpush:"size"`
+	Geometry *geojson.Geometry `pgpush:"geometry"`
+}
+
+func TestStructColumnsUint(t *testing.T) {
+	columns, err := StructColumns(blobRow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Column{
+		{Name: "id", Type: BigInt, PrimaryKey: true, KeepColumn: true},
+		{Name: "data", Type: Bytea, KeepColumn: true},
+		{Name: "size", Type: Numeric, KeepColumn: true},
+		{Name: "geometry", Type: Geometry, KeepColumn: true},
+	}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("StructColumns = %+v, want %+v", columns, want)
+	}
+}
+
+func TestStructFieldsCached(t *testing.T) {
+	first, err := structFields(reflect.TypeOf(blobRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := structFields(reflect.TypeOf(&blobRow{}))
+	if &first[0] != &second[0] {
+		t.Errorf("structFields mapped blobRow twice")
+	}
+}
+
+// the bytes of a []byte field reach the batch unchanged
+func TestAddStructBytes(t *testing.T) {
+	columns, err := StructColumns(blobRow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := NewTable("blobs", columns)
+	data := []byte("hi\x00\xff")
+	err = table.AddStruct(blobRow{ID: 1, Data: data, Size: 1 << 63, Geometry: geojson.NewPointGeometry([]float64{1, 2})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, boolval := table.CurrentInterfaceList[1].([]byte); !boolval || !bytes.Equal(got, data) {
+		t.Errorf("data value = %#v, want %#v", table.CurrentInterfaceList[1], data)
+	}
+	if got := table.CurrentInterfaceList[2]; got != "9223372036854775808" {
+		t.Errorf("size value = %#v, want 9223372036854775808", got)
+	}
+}
+
+// writes and reads back a []byte field, needs PGPUSH_TEST_DATABASE
+// set to a postgres url with postgis available
+func TestStructBytesRoundTrip(t *testing.T) {
+	uri := os.Getenv("PGPUSH_TEST_DATABASE")
+	if uri == "" {
+		t.Skip("PGPUSH_TEST_DATABASE not set")
+	}
+	connconfig, err := pgx.ParseURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := pgx.NewConnPool(pgx.ConnPoolConfig{ConnConfig: connconfig, MaxConnections: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	columns, err := StructColumns(blobRow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := CreateTableDB(ctx, "pgpush_test_blobs", columns, p, CreateDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("hi\x00\xff")
+	err = table.AddStruct(blobRow{ID: 1, Data: data, Size: 1 << 63, Geometry: geojson.NewPointGeometry([]float64{1, 2})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Exec("DROP TABLE pgpush_test_blobs")
+
+	var data_read []byte
+	err = p.QueryRow("select data from pgpush_test_blobs where id = 1").Scan(&data_read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data_read, data) {
+		t.Errorf("read %#v, want %#v", data_read, data)
+	}
+}
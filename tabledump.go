@@ -1,6 +1,7 @@
 package pgpush
 
 import (
+	"context"
 	"fmt"
 	"github.com/jackc/pgx"
 	_ "github.com/lib/pq"
@@ -8,6 +9,7 @@ import (
 	"github.com/paulmach/go.geojson"
 	"os"
 	"strings"
+	"time"
 )
 
 var SQLUser = "postgres"
@@ -16,13 +18,20 @@ var SQLPassword = ""
 // this function takes a table database and sql
 // and returns the fields that arent geometry
 // and the geometry field
-func ColumnsGeometryKey(tablename string, database string, db *pgx.ConnPool) ([]string, string) {
+func ColumnsGeometryKey(tablename string, database string, db *pgx.ConnPool) ([]string, string, error) {
+	return ColumnsGeometryKeyContext(context.Background(), tablename, database, db)
+}
+
+// ColumnsGeometryKey using the given context for the query
+func ColumnsGeometryKeyContext(ctx context.Context, tablename string, database string, db *pgx.ConnPool) ([]string, string, error) {
 	// getting the appropriate columns to build a query
 	// we really just need all the but geometry
-	result, err := db.Query(fmt.Sprintf("select column_name, data_type from INFORMATION_SCHEMA.COLUMNS where table_name = '%s';", tablename))
+	schema, name := SplitTableName(tablename)
+	result, err := db.QueryEx(ctx, "select column_name, data_type from INFORMATION_SCHEMA.COLUMNS where "+tableFilter+" order by ordinal_position;", nil, name, schema)
 	if err != nil {
-		fmt.Println(err)
+		return nil, "", newTableError(tablename, OpQuery, err)
 	}
+	defer result.Close()
 
 	columns := []string{}
 	var geometrykey string
@@ -31,7 +40,7 @@ func ColumnsGeometryKey(tablename string, database string, db *pgx.ConnPool) ([]
 		// scanning the key and the typeval
 		err = result.Scan(&key, &typeval)
 		if err != nil {
-			fmt.Println(err)
+			return nil, "", newTableError(tablename, OpQuery, err)
 		}
 
 		// collecting the columns
@@ -41,29 +50,147 @@ func ColumnsGeometryKey(tablename string, database string, db *pgx.ConnPool) ([]
 			columns = append(columns, key)
 		}
 	}
-	return columns, geometrykey
+	if result.Err() != nil {
+		return nil, "", newTableError(tablename, OpQuery, result.Err())
+	}
+	return columns, geometrykey, nil
+}
+
+// this function returns the underlying type name of each column
+// in a table i.e. jsonb, hstore, geometry
+func ColumnTypes(tablename string, db *pgx.ConnPool) (map[string]string, error) {
+	return ColumnTypesContext(context.Background(), tablename, db)
+}
+
+// ColumnTypes using the given context for the query
+func ColumnTypesContext(ctx context.Context, tablename string, db *pgx.ConnPool) (map[string]string, error) {
+	schema, name := SplitTableName(tablename)
+	result, err := db.QueryEx(ctx, "select column_name, udt_name from INFORMATION_SCHEMA.COLUMNS where "+tableFilter+";", nil, name, schema)
+	if err != nil {
+		return nil, newTableError(tablename, OpQuery, err)
+	}
+	defer result.Close()
+
+	columntypes := map[string]string{}
+	var key, typeval string
+	for result.Next() {
+		err = result.Scan(&key, &typeval)
+		if err != nil {
+			return nil, newTableError(tablename, OpQuery, err)
+		}
+		columntypes[key] = typeval
+	}
+	if result.Err() != nil {
+		return nil, newTableError(tablename, OpQuery, result.Err())
+	}
+	return columntypes, nil
+}
+
+// returns the jsonb columns a table stored whole sets of properties in
+// with JSONBAllProperties or JSONBUnmappedProperties
+func CatchAllColumns(tablename string, db *pgx.ConnPool) (map[string]bool, error) {
+	return CatchAllColumnsContext(context.Background(), tablename, db)
+}
+
+// CatchAllColumns using the given context for the query
+func CatchAllColumnsContext(ctx context.Context, tablename string, db *pgx.ConnPool) (map[string]bool, error) {
+	result, err := db.QueryEx(ctx, "select attname from pg_attribute where attrelid = $1::regclass and col_description(attrelid, attnum) = $2;", nil, QuoteTableName(tablename), catchAllComment)
+	if err != nil {
+		return nil, newTableError(tablename, OpQuery, err)
+	}
+	defer result.Close()
+
+	catchall := map[string]bool{}
+	var key string
+	for result.Next() {
+		err = result.Scan(&key)
+		if err != nil {
+			return nil, newTableError(tablename, OpQuery, err)
+		}
+		catchall[key] = true
+	}
+	if result.Err() != nil {
+		return nil, newTableError(tablename, OpQuery, result.Err())
+	}
+	return catchall, nil
+}
+
+// expands hstore columns and catch-all jsonb columns in a properties map
+// into the properties themselves so features read back the way they were
+// added, any other jsonb column stays nested under its own key as does
+// a catch-all whose value isn't an object
+func ExpandProperties(properties map[string]interface{}, columntypes map[string]string, catchall map[string]bool) error {
+	for key, typeval := range columntypes {
+		var values map[string]interface{}
+		switch typeval {
+		case "jsonb":
+			if !catchall[key] {
+				continue
+			}
+			object, boolval := properties[key].(map[string]interface{})
+			if !boolval {
+				continue
+			}
+			values = object
+		case "hstore":
+			if properties[key] == nil {
+				delete(properties, key)
+				continue
+			}
+			tags, err := HStoreProperties(properties[key])
+			if err != nil {
+				return err
+			}
+			values = tags
+		default:
+			continue
+		}
+
+		delete(properties, key)
+		for k, v := range values {
+			_, exists := properties[k]
+			if !exists {
+				properties[k] = v
+			}
+		}
+	}
+	return nil
 }
 
 // this function gets the srid for a given geometry type
-func GetSRID(geometrykey string, tablename string, db *pgx.ConnPool) int {
-	sqlstring := fmt.Sprintf(`select ST_SRID(%s) from %s limit 1;`, geometrykey, tablename)
+// an empty table gives the DefaultSRID
+func GetSRID(geometrykey string, tablename string, db *pgx.ConnPool) (int, error) {
+	return GetSRIDContext(context.Background(), geometrykey, tablename, db)
+}
+
+// GetSRID using the given context for the query
+func GetSRIDContext(ctx context.Context, geometrykey string, tablename string, db *pgx.ConnPool) (int, error) {
+	sqlstring := fmt.Sprintf(`select ST_SRID(%s) from %s limit 1;`, QuoteIdentifier(geometrykey), QuoteTableName(tablename))
 	var srid int64
 
-	err := db.QueryRow(sqlstring).Scan(&srid)
-	if err != nil {
-		fmt.Println(err)
+	err := db.QueryRowEx(ctx, sqlstring, nil).Scan(&srid)
+	if err == pgx.ErrNoRows {
+		return DefaultSRID, nil
+	} else if err != nil {
+		return 0, newTableError(tablename, OpQuery, err)
 	}
-	return int(srid)
+	return int(srid), nil
 }
 
 // reads all the feautres from an sql table and returns them as a geobuf file
 func ReadTableSQL(tablename string, database string, outfilename string) (*g.Reader, error) {
+	return ReadTableSQLContext(context.Background(), tablename, database, outfilename)
+}
+
+// reads all the features from an sql table into a geobuf file
+// stopping the query when the context is cancelled
+func ReadTableSQLContext(ctx context.Context, tablename string, database string, outfilename string) (*g.Reader, error) {
 	config := pgx.ConnPoolConfig{
 		ConnConfig: pgx.ConnConfig{
 			Host:     "localhost",
 			Port:     5432,
 			Database: database,
-			User:     SQLPassword,
+			User:     SQLUser,
 		},
 		MaxConnections: 1,
 	}
@@ -76,33 +203,56 @@ func ReadTableSQL(tablename string, database string, outfilename string) (*g.Rea
 	// creating the connection
 	p, err := pgx.NewConnPool(config)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
+	defer p.Close()
 
 	// getting the columns and geometry key
-	columns, geometrykey := ColumnsGeometryKey(tablename, database, p)
+	columns, geometrykey, err := ColumnsGeometryKeyContext(ctx, tablename, database, p)
+	if err != nil {
+		return nil, err
+	}
+
+	// getting the column types for expanding hstore and jsonb columns
+	columntypes, err := ColumnTypesContext(ctx, tablename, p)
+	if err != nil {
+		return nil, err
+	}
+	catchall, err := CatchAllColumnsContext(ctx, tablename, p)
+	if err != nil {
+		return nil, err
+	}
 
 	// getting srid number
-	srid := GetSRID(geometrykey, tablename, p)
+	srid, err := GetSRIDContext(ctx, geometrykey, tablename, p)
+	if err != nil {
+		return nil, err
+	}
 
 	// adding the st_transform component if needed
+	geometrykey = QuoteIdentifier(geometrykey)
 	if srid != 4326 {
 		geometrykey = fmt.Sprintf("ST_Transform(%s,4326)", geometrykey)
 	}
 
 	// creating values needed to form query string
 	geometrystring := fmt.Sprintf("ST_AsGeoJSON(%s)", geometrykey)
-	valstring := strings.Join(columns, ",")
-	querystring := fmt.Sprintf("select %s,%s from %s", valstring, geometrystring, tablename)
+	quoted := make([]string, len(columns))
+	for pos, key := range columns {
+		quoted[pos] = QuoteIdentifier(key)
+	}
+	valstring := strings.Join(quoted, ",")
+	querystring := fmt.Sprintf("select %s,%s from %s", valstring, geometrystring, QuoteTableName(tablename))
 
 	// creating geobuf writer
 	buf := g.WriterFileNew(outfilename)
 
 	// creating query and performing query operation
-	rows, err := p.Query(querystring)
+	rows, err := p.QueryEx(ctx, querystring, nil)
 	if err != nil {
-		fmt.Println(err)
+		return nil, newTableError(tablename, OpQuery, err)
 	}
+	defer rows.Close()
 
 	// getting geometry field and trimming keys
 	geometrypos := len(columns)
@@ -112,7 +262,7 @@ func ReadTableSQL(tablename string, database string, outfilename string) (*g.Rea
 	for rows.Next() {
 		vals, err := rows.Values()
 		if err != nil {
-			fmt.Println(err)
+			return nil, newTableError(tablename, OpQuery, err)
 		}
 
 		// creating the properties map
@@ -120,30 +270,55 @@ func ReadTableSQL(tablename string, database string, outfilename string) (*g.Rea
 		for pos, key := range columns {
 			tempmap[key] = vals[pos]
 		}
+		err = ExpandProperties(tempmap, columntypes, catchall)
+		if err != nil {
+			return nil, err
+		}
+
+		// writing timestamps and dates as rfc 3339 strings
+		for key, val := range tempmap {
+			t, boolval := val.(time.Time)
+			if boolval {
+				tempmap[key] = t.Format(time.RFC3339Nano)
+			}
+		}
 
 		// getting geometry
-		geometry.Scan(vals[geometrypos])
+		err = geometry.Scan(vals[geometrypos])
+		if err != nil {
+			return nil, err
+		}
 
 		// assemblign feature
 		feature := &geojson.Feature{Geometry: &geometry, Properties: tempmap}
 
 		// if osm_id is in the properties map add that as an id
-		val, boolval := tempmap["osm_id"]
-		if boolval {
-			valint, boolval2 := val.(int)
-			if boolval2 {
-				feature.ID = valint
-			}
+		switch val := tempmap["osm_id"].(type) {
+		case int:
+			feature.ID = val
+		case int64:
+			feature.ID = val
 		}
 
 		// adding the feature to geobuf
 		buf.WriteFeature(feature)
 	}
-	return buf.Reader(), err
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if rows.Err() != nil {
+		return nil, newTableError(tablename, OpQuery, rows.Err())
+	}
+	return buf.Reader(), nil
 }
 
 // creates a geojson from a given sql table
 func TableToGeoJSON(tablename string, database string, outfilename string) error {
+	return TableToGeoJSONContext(context.Background(), tablename, database, outfilename)
+}
+
+// creates a geojson from a given sql table using the given context
+func TableToGeoJSONContext(ctx context.Context, tablename string, database string, outfilename string) error {
 	var geojsonbool bool
 	var geobuf_filename, geojsonfilename string
 	if strings.HasSuffix(outfilename, "geojson") {
@@ -155,7 +330,7 @@ func TableToGeoJSON(tablename string, database string, outfilename string) error
 	}
 
 	// creating geobuf
-	buf, err := ReadTableSQL(tablename, database, geobuf_filename)
+	buf, err := ReadTableSQLContext(ctx, tablename, database, geobuf_filename)
 	if err != nil {
 		return err
 	}
@@ -165,9 +340,9 @@ func TableToGeoJSON(tablename string, database string, outfilename string) error
 		// creating geojson file
 		g.ConvertGeobuf(buf.Filename, geojsonfilename)
 		os.Remove(buf.Filename)
-		fmt.Printf("Output geojson file created %s.\n", geojsonfilename)
+		DefaultLogger.Info("output file created", "table", tablename, "filename", geojsonfilename)
 	} else {
-		fmt.Printf("Output geojson file created %s.\n", geobuf_filename)
+		DefaultLogger.Info("output file created", "table", tablename, "filename", geobuf_filename)
 	}
 
 	return nil
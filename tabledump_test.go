@@ -0,0 +1,60 @@
+package pgpush
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandProperties(t *testing.T) {
+	columntypes := map[string]string{"meta": "jsonb", "properties": "jsonb", "tags": "hstore", "name": "text"}
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		catchall   map[string]bool
+		want       map[string]interface{}
+	}{
+		{
+			name:       "property column stays nested",
+			properties: map[string]interface{}{"meta": map[string]interface{}{"a": 1.0}},
+			want:       map[string]interface{}{"meta": map[string]interface{}{"a": 1.0}},
+		},
+		{
+			name:       "catch-all column is expanded",
+			properties: map[string]interface{}{"properties": map[string]interface{}{"a": 1.0}, "name": "x"},
+			catchall:   map[string]bool{"properties": true},
+			want:       map[string]interface{}{"a": 1.0, "name": "x"},
+		},
+		{
+			name:       "columns win over catch-all keys",
+			properties: map[string]interface{}{"properties": map[string]interface{}{"name": "y"}, "name": "x"},
+			catchall:   map[string]bool{"properties": true},
+			want:       map[string]interface{}{"name": "x"},
+		},
+		{
+			name:       "catch-all that isn't an object is kept",
+			properties: map[string]interface{}{"properties": "text"},
+			catchall:   map[string]bool{"properties": true},
+			want:       map[string]interface{}{"properties": "text"},
+		},
+		{
+			name:       "hstore is expanded",
+			properties: map[string]interface{}{"tags": map[string]string{"highway": "primary"}},
+			want:       map[string]interface{}{"highway": "primary"},
+		},
+		{
+			name:       "null hstore is dropped",
+			properties: map[string]interface{}{"tags": nil, "name": "x"},
+			want:       map[string]interface{}{"name": "x"},
+		},
+	}
+	for _, test := range tests {
+		err := ExpandProperties(test.properties, columntypes, test.catchall)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.properties, test.want) {
+			t.Errorf("%s: got %v want %v", test.name, test.properties, test.want)
+		}
+	}
+}
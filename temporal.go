@@ -0,0 +1,119 @@
+package pgpush
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// the layouts string values are parsed with for timestamp and date
+// columns without a TimeLayout, tried in order
+var DefaultTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// returns whether the column type is a timestamp, date, time or interval
+func IsTemporal(columntype ColumnType) bool {
+	switch columntype.Category() {
+	case "timestamp", "date", "time", "interval":
+		return true
+	}
+	return false
+}
+
+// converts a property value into the text of a timestamp, date, time
+// or interval for the column
+// strings are parsed with the column's TimeLayout or the DefaultTimeLayouts,
+// numbers are epochs (or durations for intervals) in the column's EpochUnit
+// time.Time and time.Duration values are used as is, nil becomes NULL
+func TemporalValue(column Column, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	category := column.Type.Category()
+	unit := column.EpochUnit
+	if unit == 0 {
+		unit = time.Second
+	}
+
+	if category == "interval" {
+		switch value := value.(type) {
+		case time.Duration:
+			return fmt.Sprintf("%d microseconds", value.Microseconds()), nil
+		case string:
+			return value, nil
+		}
+		number, boolval := epochValue(value)
+		if !boolval {
+			return nil, fmt.Errorf("cannot convert %T to an interval for %s", value, column.Name)
+		}
+		return fmt.Sprintf("%d microseconds", int64(number*float64(unit)/float64(time.Microsecond))), nil
+	}
+
+	var t time.Time
+	switch val := value.(type) {
+	case time.Time:
+		t = val
+	case string:
+		// time of day strings are left to postgres without a layout
+		if category == "time" && column.TimeLayout == "" {
+			return val, nil
+		}
+		parsed, err := parseTime(column, val)
+		if err != nil {
+			return nil, err
+		}
+		t = parsed
+	default:
+		number, boolval := epochValue(value)
+		if !boolval {
+			return nil, fmt.Errorf("cannot convert %T to a %s for %s", value, category, column.Name)
+		}
+		t = time.Unix(0, int64(number*float64(unit))).UTC()
+	}
+
+	withzone := strings.Contains(string(column.Type), "with time zone")
+	switch category {
+	case "date":
+		return t.Format("2006-01-02"), nil
+	case "time":
+		if withzone {
+			return t.Format("15:04:05.999999Z07:00"), nil
+		}
+		return t.Format("15:04:05.999999"), nil
+	}
+	if withzone {
+		return t.Format("2006-01-02 15:04:05.999999Z07:00"), nil
+	}
+	return t.UTC().Format("2006-01-02 15:04:05.999999"), nil
+}
+
+// parses a string with the column's layout or the DefaultTimeLayouts
+func parseTime(column Column, value string) (time.Time, error) {
+	if column.TimeLayout != "" {
+		return time.Parse(column.TimeLayout, value)
+	}
+	for _, layout := range DefaultTimeLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time for %s", value, column.Name)
+}
+
+// returns a numeric property value as a float
+func epochValue(value interface{}) (float64, bool) {
+	myval, typeval := ParseValue(value)
+	switch typeval {
+	case "int":
+		return float64(myval.(int)), true
+	case "float":
+		return myval.(float64), true
+	}
+	return 0, false
+}
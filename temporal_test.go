@@ -0,0 +1,76 @@
+package pgpush
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemporalValue(t *testing.T) {
+	when := time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.FixedZone("", 2*3600))
+	tests := []struct {
+		column Column
+		value  interface{}
+		want   interface{}
+		fails  bool
+	}{
+		{Column{Type: TimestampWithTimezone}, nil, nil, false},
+		{Column{Type: TimestampWithTimezone}, when, "2024-05-06 07:08:09.123456+02:00", false},
+		{Column{Type: TimestampWithoutTimezone}, when, "2024-05-06 05:08:09.123456", false},
+		{Column{Type: Date}, when, "2024-05-06", false},
+		{Column{Type: TimeWithoutTimezone}, when, "07:08:09.123456", false},
+		{Column{Type: TimeWithTimezone}, when, "07:08:09.123456+02:00", false},
+
+		// strings are parsed with the default layouts
+		{Column{Type: TimestampWithTimezone}, "2024-05-06T07:08:09Z", "2024-05-06 07:08:09Z", false},
+		{Column{Type: TimestampWithoutTimezone}, "2024-05-06 07:08:09", "2024-05-06 07:08:09", false},
+		{Column{Type: Date}, "2024-05-06", "2024-05-06", false},
+		{Column{Type: Date}, "not a date", nil, true},
+		// or the column's own layout
+		{Column{Type: Date, TimeLayout: "02/01/2006"}, "06/05/2024", "2024-05-06", false},
+		{Column{Type: Date, TimeLayout: "02/01/2006"}, "2024-05-06", nil, true},
+		// time of day strings are left to postgres without a layout
+		{Column{Type: TimeWithoutTimezone}, "07:08", "07:08", false},
+
+		// numbers are epochs in the column's unit
+		{Column{Type: TimestampWithTimezone}, 0.0, "1970-01-01 00:00:00Z", false},
+		{Column{Type: TimestampWithoutTimezone}, 1714979289.0, "2024-05-06 07:08:09", false},
+		{Column{Type: TimestampWithoutTimezone, EpochUnit: time.Millisecond}, 1714979289500.0, "2024-05-06 07:08:09.5", false},
+		{Column{Type: Date}, 86400, "1970-01-02", false},
+		{Column{Type: Date}, true, nil, true},
+
+		// intervals take durations, strings and numbers in the unit
+		{Column{Type: Interval}, 90 * time.Second, "90000000 microseconds", false},
+		{Column{Type: Interval}, "1 day", "1 day", false},
+		{Column{Type: Interval}, 2.5, "2500000 microseconds", false},
+		{Column{Type: Interval, EpochUnit: time.Minute}, 2, "120000000 microseconds", false},
+		{Column{Type: Interval}, true, nil, true},
+	}
+	for _, test := range tests {
+		test.column.Name = "when"
+		got, err := TemporalValue(test.column, test.value)
+		if test.fails {
+			if err == nil {
+				t.Errorf("TemporalValue(%s, %#v) = %v, want an error", test.column.Type, test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("TemporalValue(%s, %#v) error: %v", test.column.Type, test.value, err)
+		} else if got != test.want {
+			t.Errorf("TemporalValue(%s, %#v) = %#v, want %#v", test.column.Type, test.value, got, test.want)
+		}
+	}
+}
+
+func TestIsTemporal(t *testing.T) {
+	for _, columntype := range []ColumnType{TimestampWithTimezone, TimestampWithoutTimezone, Date, TimeWithTimezone, TimeWithoutTimezone, Interval} {
+		if !IsTemporal(columntype) {
+			t.Errorf("IsTemporal(%s) = false", columntype)
+		}
+	}
+	for _, columntype := range []ColumnType{Text, BigInt, JSONB, ArrayOf(Date)} {
+		if IsTemporal(columntype) {
+			t.Errorf("IsTemporal(%s) = true", columntype)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+//go:build go1.18
+
+package pgpush
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+	"github.com/paulmach/go.geojson"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// returns the text value of a field for a column
+type fieldFunc func(vv reflect.Value) (interface{}, error)
+
+// a typed table's accessor for a column and the index of its field
+type typedField struct {
+	Index []int
+	Value fieldFunc
+}
+
+// a table of structs of type T, the value of each column is read from
+// the struct's fields with accessors built once for the type so rows
+// are added without looking up fields, interface conversions or fmt.Sprint
+// the embedded Table is used for flushing, committing and closing
+type TypedTable[T any] struct {
+	*Table
+	fields []typedField
+}
+
+// wraps a table for structs of type T, every column of the table
+// needs a field mapped to it the way StructColumns maps them
+func NewTypedTable[T any](table *Table) (*TypedTable[T], error) {
+	var zero T
+	typ := reflect.TypeOf(zero)
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot map %T to a typed table", zero)
+	}
+	structfields, err := structFields(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]typedField, len(table.Columns))
+	for pos, column := range table.Columns {
+		var field *structField
+		for i := range structfields {
+			if structfields[i].Column.Name == column.Name {
+				field = &structfields[i]
+			}
+		}
+		if field == nil {
+			return nil, fmt.Errorf("%s has no field for column %q", typ, column.Name)
+		}
+		fn, err := fieldValueFunc(typ.FieldByIndex(field.Index).Type, column)
+		if err != nil {
+			return nil, err
+		}
+		fields[pos] = typedField{Index: field.Index, Value: fn}
+	}
+	return &TypedTable[T]{Table: table, fields: fields}, nil
+}
+
+// creates a table for structs of type T with the columns from StructColumns
+func CreateTypedTable[T any](tablename string, config pgx.ConnPoolConfig, mode CreateMode) (*TypedTable[T], error) {
+	return CreateTypedTableContext[T](context.Background(), tablename, config, mode)
+}
+
+// creates a table for structs of type T using the given context
+func CreateTypedTableContext[T any](ctx context.Context, tablename string, config pgx.ConnPoolConfig, mode CreateMode) (*TypedTable[T], error) {
+	var zero T
+	columns, err := StructColumns(zero)
+	if err != nil {
+		return nil, err
+	}
+	table, err := CreateTableContext(ctx, tablename, columns, config, mode)
+	if err != nil {
+		return nil, err
+	}
+	typed, err := NewTypedTable[T](table)
+	if err != nil {
+		table.Rollback()
+		table.Close()
+		return nil, err
+	}
+	return typed, nil
+}
+
+// adds a struct to the table
+func (table *TypedTable[T]) Add(value *T) error {
+	return table.AddContext(context.Background(), value)
+}
+
+// adds a struct to the table using the given context
+func (table *TypedTable[T]) AddContext(ctx context.Context, value *T) error {
+	if table.closed {
+		return ErrTableClosed
+	}
+	if ctx.Err() != nil {
+		return table.abort(ctx.Err())
+	}
+
+	if value == nil {
+		return table.reject(&geojson.Feature{}, fmt.Errorf("cannot add a nil %T", value))
+	}
+
+	// the feature is only built when something needs it
+	var feature *geojson.Feature
+	if table.keepFeatures() {
+		feature = reportFeature(value)
+	}
+
+	vv := reflect.ValueOf(value).Elem()
+	values := make([]interface{}, len(table.fields))
+	for pos, field := range table.fields {
+		// a nil embedded pointer leaves its fields nil
+		fieldval, boolval := fieldValue(vv, field.Index)
+		if !boolval {
+			continue
+		}
+		val, err := field.Value(fieldval)
+		if err != nil {
+			return table.reject(reportFeature(value), err)
+		}
+		values[pos] = val
+	}
+	return table.addRow(ctx, values, feature)
+}
+
+// converts a struct into a feature for dead letters and hooks
+// an empty feature if it can't be converted
+func reportFeature(value interface{}) *geojson.Feature {
+	feature, err := StructFeature(value)
+	if err != nil {
+		return &geojson.Feature{}
+	}
+	return feature
+}
+
+// adds every struct in the slice stopping at the first error
+func (table *TypedTable[T]) AddAll(values []T) error {
+	return table.AddAllContext(context.Background(), values)
+}
+
+// adds every struct in the slice using the given context
+func (table *TypedTable[T]) AddAllContext(ctx context.Context, values []T) error {
+	for pos := range values {
+		err := table.AddContext(ctx, &values[pos])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reads every row of a table into structs of type T
+func ReadTyped[T any](tablename string, db DB) ([]T, error) {
+	return ReadTypedContext[T](context.Background(), tablename, db)
+}
+
+// reads every row of a table into structs of type T using the given context
+func ReadTypedContext[T any](ctx context.Context, tablename string, db DB) ([]T, error) {
+	values := []T{}
+	err := ReadStructsContext(ctx, tablename, db, &values)
+	return values, err
+}
+
+// builds the accessor for a field of the given type
+// values are sent as text apart from hstore, jsonb and geometry columns
+// a field that can't be encoded as its column's type is an error
+func fieldValueFunc(typ reflect.Type, column Column) (fieldFunc, error) {
+	category := column.Type.Category()
+	if category == "jsonb" {
+		return func(vv reflect.Value) (interface{}, error) {
+			return newJSONB(vv.Interface())
+		}, nil
+	}
+	if typ.Kind() == reflect.Ptr {
+		elem, err := fieldValueFunc(typ.Elem(), column)
+		if err != nil {
+			return nil, err
+		}
+		return func(vv reflect.Value) (interface{}, error) {
+			if vv.IsNil() {
+				return nil, nil
+			}
+			return elem(vv.Elem())
+		}, nil
+	}
+	mismatch := fmt.Errorf("cannot encode %s as %s for column %q", typ, column.Type, column.Name)
+
+	switch {
+	case typ == geometryType && category == "geometry":
+		return func(vv reflect.Value) (interface{}, error) {
+			return EncodeGeometryWKB(vv.Addr().Interface().(*geojson.Geometry))
+		}, nil
+	case typ == geometryType || category == "geometry":
+		return nil, mismatch
+	case typ == timeType && IsTemporal(column.Type):
+		return func(vv reflect.Value) (interface{}, error) {
+			return TemporalValue(column, *vv.Addr().Interface().(*time.Time))
+		}, nil
+	case typ == timeType && (category == "string" || category == ""):
+		return func(vv reflect.Value) (interface{}, error) {
+			return vv.Addr().Interface().(*time.Time).Format(time.RFC3339Nano), nil
+		}, nil
+	case typ == timeType:
+		return nil, mismatch
+	}
+
+	var text func(vv reflect.Value) string
+	switch typ.Kind() {
+	case reflect.String:
+		text = func(vv reflect.Value) string { return vv.String() }
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		text = func(vv reflect.Value) string { return strconv.FormatInt(vv.Int(), 10) }
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		text = func(vv reflect.Value) string { return strconv.FormatUint(vv.Uint(), 10) }
+	case reflect.Float64:
+		text = func(vv reflect.Value) string { return strconv.FormatFloat(vv.Float(), 'f', -1, 64) }
+	case reflect.Float32:
+		text = func(vv reflect.Value) string { return strconv.FormatFloat(vv.Float(), 'f', -1, 32) }
+	case reflect.Bool:
+		text = func(vv reflect.Value) string { return strconv.FormatBool(vv.Bool()) }
+	}
+	if text != nil {
+		if !scalarEncodes(typ.Kind(), category) {
+			return nil, mismatch
+		}
+		if IsTemporal(column.Type) {
+			// strings and epochs still get parsed for temporal columns
+			return func(vv reflect.Value) (interface{}, error) {
+				return TemporalValue(column, vv.Interface())
+			}, nil
+		}
+		return func(vv reflect.Value) (interface{}, error) { return text(vv), nil }, nil
+	}
+
+	switch {
+	case typ == reflect.TypeOf([]byte(nil)) && category == "string":
+		return func(vv reflect.Value) (interface{}, error) { return vv.Bytes(), nil }, nil
+	case typ == reflect.TypeOf(map[string]string(nil)) && category == "hstore":
+		return func(vv reflect.Value) (interface{}, error) {
+			if vv.IsNil() {
+				return nil, nil
+			}
+			hstore := &pgtype.Hstore{}
+			err := hstore.Set(vv.Interface().(map[string]string))
+			return hstore, err
+		}, nil
+	case typ.Kind() == reflect.Slice && scalarType(typ.Elem()) && category == "array":
+		elem, err := fieldValueFunc(typ.Elem(), Column{Name: column.Name, Type: column.Type.Element(), TimeLayout: column.TimeLayout, EpochUnit: column.EpochUnit})
+		if err != nil {
+			return nil, err
+		}
+		return func(vv reflect.Value) (interface{}, error) {
+			if vv.IsNil() {
+				return nil, nil
+			}
+			array_lines := make([]string, vv.Len())
+			for pos := range array_lines {
+				val, err := elem(vv.Index(pos))
+				if err != nil {
+					return nil, err
+				}
+				if val == nil {
+					array_lines[pos] = "NULL"
+				} else {
+					array_lines[pos] = QuoteArrayElement(val.(string))
+				}
+			}
+			return "{" + strings.Join(array_lines, ",") + "}", nil
+		}, nil
+	}
+	return nil, mismatch
+}
+
+// returns whether a scalar of the given kind can be written as text to
+// a column of the given category, strings are left to postgres to parse
+// and columns of types without a category take any scalar
+func scalarEncodes(kind reflect.Kind, category string) bool {
+	if kind == reflect.String {
+		return category != "hstore" && category != "array"
+	}
+	isint := kind >= reflect.Int && kind <= reflect.Int64
+	isuint := kind >= reflect.Uint && kind <= reflect.Uint64
+	isfloat := kind == reflect.Float32 || kind == reflect.Float64
+	switch category {
+	case "", "string":
+		return true
+	case "int":
+		return isint || isuint
+	case "float":
+		return isint || isuint || isfloat
+	case "bool":
+		return kind == reflect.Bool
+	case "timestamp", "date", "time", "interval":
+		// numbers are epochs or durations
+		return isint || isfloat
+	}
+	return false
+}
+
+// returns whether the type is written as text, making slices
+// of it arrays
+func scalarType(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == timeType {
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
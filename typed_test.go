@@ -0,0 +1,328 @@
+//go:build go1.18
+
+package pgpush
+
+import (
+	"github.com/jackc/pgx/pgtype"
+	"github.com/paulmach/go.geojson"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type typedKinds struct {
+	Geometry  geojson.Geometry  `pgpush:"geometry"`
+	String    string            `pgpush:"string"`
+	Int       int               `pgpush:"int"`
+	Int64     int64             `pgpush:"int64"`
+	Int32     int32             `pgpush:"int32"`
+	Int16     int16             `pgpush:"int16"`
+	Int8      int8              `pgpush:"int8"`
+	Uint      uint              `pgpush:"uint"`
+	Uint64    uint64            `pgpush:"uint64"`
+	Uint32    uint32            `pgpush:"uint32"`
+	Uint16    uint16            `pgpush:"uint16"`
+	Uint8     uint8             `pgpush:"uint8"`
+	Float64   float64           `pgpush:"float64"`
+	Float32   float32           `pgpush:"float32"`
+	Bool      bool              `pgpush:"bool"`
+	Time      time.Time         `pgpush:"time"`
+	Date      string            `pgpush:"date,type=date"`
+	Epoch     int64             `pgpush:"epoch,type=timestamp with time zone"`
+	Duration  time.Duration     `pgpush:"duration,type=interval"`
+	Bytes     []byte            `pgpush:"bytes"`
+	Tags      map[string]string `pgpush:"tags"`
+	Props     map[string]int    `pgpush:"props"`
+	Strings   []string          `pgpush:"strings"`
+	Floats    []float64         `pgpush:"floats"`
+	Ints      []int             `pgpush:"ints"`
+	Nested    struct{ A int }   `pgpush:"nested,type=jsonb"`
+	StringPtr *string           `pgpush:"string_ptr"`
+	IntPtr    *int              `pgpush:"int_ptr"`
+	TimePtr   *time.Time        `pgpush:"time_ptr"`
+	IntPtrs   []*int            `pgpush:"int_ptrs"`
+	NilPtr    *float64          `pgpush:"nil_ptr"`
+	NilSlice  []string          `pgpush:"nil_slice"`
+	NilTags   map[string]string `pgpush:"nil_tags"`
+}
+
+func newTypedKinds(t testing.TB) *TypedTable[typedKinds] {
+	columns, err := StructColumns(typedKinds{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	typed, err := NewTypedTable[typedKinds](NewTable("typed_kinds", columns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return typed
+}
+
+func TestTypedTableKinds(t *testing.T) {
+	typed := newTypedKinds(t)
+	s, i := "ptr", 7
+	when := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	value := typedKinds{
+		Geometry: *geojson.NewPointGeometry([]float64{1, 2}),
+		String:   "text", Int: -1, Int64: 1 << 40, Int32: -32, Int16: 16, Int8: -8,
+		Uint: 1, Uint64: 1 << 63, Uint32: 32, Uint16: 16, Uint8: 8,
+		Float64: 1e6, Float32: 0.5, Bool: true,
+		Time: when, Date: "2024-05-06", Epoch: 0, Duration: 2 * time.Second,
+		Bytes:     []byte{0, 1},
+		Tags:      map[string]string{"a": "b"},
+		Props:     map[string]int{"a": 1},
+		Strings:   []string{"a", `b"c`},
+		Floats:    []float64{1e6, 1.5},
+		Ints:      []int{1, 2},
+		Nested:    struct{ A int }{A: 3},
+		StringPtr: &s, IntPtr: &i, TimePtr: &when,
+		IntPtrs: []*int{&i, nil},
+	}
+	err := typed.Add(&value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wkb, err := EncodeGeometryWKB(&value.Geometry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"geometry":   wkb,
+		"string":     "text",
+		"int":        "-1",
+		"int64":      "1099511627776",
+		"int32":      "-32",
+		"int16":      "16",
+		"int8":       "-8",
+		"uint":       "1",
+		"uint64":     "9223372036854775808",
+		"uint32":     "32",
+		"uint16":     "16",
+		"uint8":      "8",
+		"float64":    "1000000",
+		"float32":    "0.5",
+		"bool":       "true",
+		"time":       "2024-05-06 07:08:09Z",
+		"date":       "2024-05-06",
+		"epoch":      "1970-01-01 00:00:00Z",
+		"duration":   "2000000 microseconds",
+		"bytes":      []byte{0, 1},
+		"strings":    `{"a","b\"c"}`,
+		"floats":     `{"1000000","1.5"}`,
+		"ints":       `{"1","2"}`,
+		"string_ptr": "ptr",
+		"int_ptr":    "7",
+		"time_ptr":   "2024-05-06 07:08:09Z",
+		"int_ptrs":   `{"7",NULL}`,
+		"nil_ptr":    nil,
+		"nil_slice":  nil,
+		"nil_tags":   nil,
+	}
+	for pos, column := range typed.Columns {
+		got := typed.CurrentInterfaceList[pos]
+		switch column.Name {
+		case "tags":
+			hstore, boolval := got.(*pgtype.Hstore)
+			if !boolval || hstore.Map["a"].String != "b" {
+				t.Errorf("tags = %#v, want an hstore of a=>b", got)
+			}
+			continue
+		case "props", "nested":
+			jsonb, boolval := got.(*pgtype.JSONB)
+			if !boolval || len(jsonb.Bytes) == 0 {
+				t.Errorf("%s = %#v, want jsonb", column.Name, got)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, want[column.Name]) {
+			t.Errorf("%s = %#v, want %#v", column.Name, got, want[column.Name])
+		}
+	}
+}
+
+// the typed path writes the same values the feature path does
+func TestTypedTableMatchesAddStruct(t *testing.T) {
+	type road struct {
+		Geometry *geojson.Geometry `pgpush:"geometry"`
+		Name     string            `pgpush:"name"`
+		Lanes    int               `pgpush:"lanes"`
+		Length   float64           `pgpush:"length"`
+		Open     bool              `pgpush:"open"`
+		Tags     []string          `pgpush:"tags"`
+	}
+	columns, err := StructColumns(road{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	typed, err := NewTypedTable[road](NewTable("roads", columns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := NewTable("roads", columns)
+	value := road{Geometry: geojson.NewLineStringGeometry([][]float64{{1, 2}, {3, 4}}), Name: "main", Lanes: 2, Length: 1e6, Open: true, Tags: []string{"a"}}
+	err = typed.Add(&value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = table.AddStruct(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(typed.CurrentInterfaceList, table.CurrentInterfaceList) {
+		t.Errorf("typed values %#v, AddStruct values %#v", typed.CurrentInterfaceList, table.CurrentInterfaceList)
+	}
+}
+
+func TestTypedTableMismatch(t *testing.T) {
+	tests := []struct {
+		typ    reflect.Type
+		column Column
+	}{
+		{reflect.TypeOf(float64(0)), Column{Name: "a", Type: Integer}},
+		{reflect.TypeOf(true), Column{Name: "a", Type: BigInt}},
+		{reflect.TypeOf(""), Column{Name: "a", Type: HStore}},
+		{reflect.TypeOf(struct{ A int }{}), Column{Name: "a", Type: Text}},
+		{reflect.TypeOf([]int{}), Column{Name: "a", Type: Text}},
+		{reflect.TypeOf([]float64{}), Column{Name: "a", Type: IntegerArray}},
+		{reflect.TypeOf(map[string]string{}), Column{Name: "a", Type: Text}},
+		{reflect.TypeOf(map[string]int{}), Column{Name: "a", Type: HStore}},
+		{reflect.TypeOf(geojson.Geometry{}), Column{Name: "a", Type: Text}},
+		{reflect.TypeOf(""), Column{Name: "geometry", Type: Geometry}},
+		{reflect.TypeOf(time.Time{}), Column{Name: "a", Type: Integer}},
+		{reflect.TypeOf(uint64(0)), Column{Name: "a", Type: Date}},
+		{reflect.TypeOf([]byte{}), Column{Name: "a", Type: Integer}},
+		{reflect.TypeOf(new(float64)), Column{Name: "a", Type: Boolean}},
+	}
+	for _, test := range tests {
+		_, err := fieldValueFunc(test.typ, test.column)
+		if err == nil {
+			t.Errorf("fieldValueFunc(%s, %s) should fail", test.typ, test.column.Type)
+		} else if !strings.Contains(err.Error(), test.column.Name) {
+			t.Errorf("fieldValueFunc(%s, %s) error %q doesn't name the column", test.typ, test.column.Type, err)
+		}
+	}
+}
+
+func TestNewTypedTableMismatch(t *testing.T) {
+	type counter struct {
+		Geometry geojson.Geometry `pgpush:"geometry"`
+		Count    uint64           `pgpush:"count,type=boolean"`
+	}
+	columns, err := StructColumns(counter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewTypedTable[counter](NewTable("counters", columns))
+	if err == nil {
+		t.Errorf("NewTypedTable should fail for a uint64 in a boolean column")
+	}
+}
+
+type benchRoad struct {
+	Geometry *geojson.Geometry `pgpush:"geometry"`
+	ID       int64             `pgpush:"id"`
+	Name     string            `pgpush:"name"`
+	Lanes    int               `pgpush:"lanes"`
+	Length   float64           `pgpush:"length"`
+	Open     bool              `pgpush:"open"`
+}
+
+func benchRoads() ([]Column, benchRoad) {
+	columns, _ := StructColumns(benchRoad{})
+	return columns, benchRoad{
+		Geometry: geojson.NewLineStringGeometry([][]float64{{1, 2}, {3, 4}, {5, 6}}),
+		ID:       1, Name: "main street", Lanes: 2, Length: 1234.5, Open: true,
+	}
+}
+
+// batches are discarded before they're due so nothing is flushed
+const benchBatch = 500
+
+func BenchmarkTypedTableAdd(b *testing.B) {
+	columns, value := benchRoads()
+	typed, err := NewTypedTable[benchRoad](NewTable("roads", columns))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		err := typed.Add(&value)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if typed.Count == benchBatch {
+			typed.resetBatch()
+		}
+	}
+}
+
+func BenchmarkAddStruct(b *testing.B) {
+	columns, value := benchRoads()
+	table := NewTable("roads", columns)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		err := table.AddStruct(&value)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if table.Count == benchBatch {
+			table.resetBatch()
+		}
+	}
+}
+
+func TestTypedTableJSONBString(t *testing.T) {
+	fn, err := fieldValueFunc(reflect.TypeOf(""), Column{Name: "note", Type: JSONB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := "hello"
+	got, err := fn(reflect.ValueOf(&value).Elem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonb, boolval := got.(*pgtype.JSONB)
+	if !boolval || string(jsonb.Bytes) != `"hello"` {
+		t.Errorf("jsonb string = %#v, want the json string \"hello\"", got)
+	}
+}
+
+func TestTypedTableEmbeddedPointer(t *testing.T) {
+	type Address struct {
+		Street string `pgpush:"street"`
+	}
+	type place struct {
+		*Address
+		Geometry geojson.Geometry `pgpush:"geometry"`
+		Name     string           `pgpush:"name"`
+	}
+	columns, err := StructColumns(place{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	typed, err := NewTypedTable[place](NewTable("places", columns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []place{
+		{Address: &Address{Street: "main"}, Geometry: *geojson.NewPointGeometry([]float64{1, 2}), Name: "a"},
+		{Geometry: *geojson.NewPointGeometry([]float64{1, 2}), Name: "b"},
+	}
+	err = typed.AddAll(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pos, column := range typed.Columns {
+		if column.Name != "street" {
+			continue
+		}
+		first, second := typed.CurrentInterfaceList[pos], typed.CurrentInterfaceList[len(columns)+pos]
+		if first != "main" || second != nil {
+			t.Errorf("streets = %#v and %#v, want main and nil", first, second)
+		}
+	}
+}
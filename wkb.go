@@ -196,7 +196,7 @@ func (e *Encoder) Encode(geom *geojson.Geometry) error {
 
 	}
 
-	panic("unsupported type")
+	return ErrUnsupportedGeometry
 }
 
 // NewEncoder creates a new Encoder for the given writer